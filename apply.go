@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+const applyUsage = `Usage:
+$ export ATC_BEARER_TOKEN="eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.eyJj....."
+$ stopover apply --url https://ci.server.tld --team my-team --pipeline my-pipeline [--ensure] [--allow-disabled] [--trigger job-a,job-b [--watch]] versions.yml
+
+Pins each resource of the pipeline to its version in the versions file, then
+optionally triggers jobs and follows their builds.`
+
+func applyCommand(args []string) {
+	flags := flag.NewFlagSet("stopover apply", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	var targetFlags targetFlags
+	targetFlags.register(flags)
+	ensure := flags.Bool("ensure", false, "check for versions the pipeline has not discovered before pinning")
+	trigger := flags.String("trigger", "", "comma-separated jobs to trigger once pinned")
+	watch := flags.Bool("watch", false, "stream the logs of triggered builds")
+	allowDisabled := flags.Bool("allow-disabled", false, "warn about disabled versions rather than failing")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 || !targetFlags.valid() || os.Getenv("ATC_BEARER_TOKEN") == "" {
+		printUsageAndExit(flags, applyUsage, ExitFailure)
+	}
+
+	snapshot, err := readVersionsFile(flags.Arg(0))
+	exitIfErr(err)
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+	target := targetFlags.target(clientFlags.client(ctx, targetFlags.url))
+
+	if *ensure {
+		exitIfErr(ensureVersions(ctx, target, snapshot, targetFlags.checkTimeout))
+	}
+
+	disabled, unknown, err := target.DisabledVersions(snapshot)
+	exitIfErr(err)
+	warnUnchecked(unknown)
+	exitIfErr(checkDisabled(disabled, *allowDisabled))
+
+	for _, entry := range snapshot.Entries {
+		switch entry.Kind {
+		case stopover.KindResourceType:
+			fmt.Fprintf(os.Stderr, "warning: not pinning resource type %s, which the ATC cannot pin; use the versions file as vars instead\n", entry.Name)
+		case stopover.KindTaskImage:
+			fmt.Fprintf(os.Stderr, "warning: not pinning the image of task %s, which is set in the task config; use the versions file as vars instead\n", entry.Name)
+		}
+	}
+
+	pinned, err := target.Pin(snapshot)
+	for _, result := range pinned {
+		fmt.Fprintf(os.Stderr, "pinned %s to version %d\n", result.Entry.Name, result.ResourceVersion.ID)
+	}
+	exitIfErr(err)
+
+	if *trigger == "" {
+		return
+	}
+
+	var builds []atc.Build
+	for _, job := range strings.Split(*trigger, ",") {
+		build, err := target.Trigger(job)
+		exitIfErr(err)
+		fmt.Fprintf(os.Stderr, "started %s build %s\n", job, build.Name)
+		builds = append(builds, build)
+	}
+
+	var firstErr error
+	for _, build := range builds {
+		if err := followBuild(ctx, target, build, snapshot, *watch); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	if firstErr != nil {
+		os.Exit(ExitCode(firstErr))
+	}
+}
+
+// followBuild waits for a triggered build to pick its inputs, checks they
+// are the snapshot's versions, and waits for it to finish.
+func followBuild(ctx context.Context, target *stopover.Target, build atc.Build, snapshot *stopover.Snapshot, watch bool) error {
+	build, err := target.WaitForStart(ctx, build)
+	if err != nil {
+		return err
+	}
+
+	if err := target.VerifyInputs(build, snapshot); err != nil {
+		return err
+	}
+
+	if watch {
+		if err := target.StreamLogs(build, os.Stdout); err != nil {
+			return err
+		}
+	}
+
+	build, err = target.WaitForBuild(ctx, build)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "%s build %s %s\n", build.JobName, build.Name, build.Status)
+	return stopover.BuildResult(build)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+const changelogUsage = `Usage:
+$ export ATC_BEARER_TOKEN="eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.eyJj....."
+$ stopover changelog --url https://ci.server.tld --team my-team --pipeline my-pipeline [--format markdown|json] old-versions.yml new-versions.yml
+
+Lists the versions of each changed resource between two versions files.`
+
+func changelogCommand(args []string) {
+	flags := flag.NewFlagSet("stopover changelog", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	url := flags.String("url", "", "ATC URL")
+	team := flags.String("team", "", "team owning the pipeline")
+	pipeline := flags.String("pipeline", "", "pipeline whose resources the versions files refer to")
+	format := flags.String("format", "markdown", "output format: markdown or json")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 2 || *url == "" || *team == "" || *pipeline == "" || os.Getenv("ATC_BEARER_TOKEN") == "" {
+		printUsageAndExit(flags, changelogUsage, ExitFailure)
+	}
+
+	if *format != "markdown" && *format != "json" {
+		printUsageAndExit(flags, changelogUsage, ExitFailure)
+	}
+
+	oldSnapshot, err := readVersionsFile(flags.Arg(0))
+	exitIfErr(err)
+	newSnapshot, err := readVersionsFile(flags.Arg(1))
+	exitIfErr(err)
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+
+	snapshotter := stopover.NewSnapshotter(stopover.WithClient(clientFlags.client(ctx, *url)))
+	changelog, err := snapshotter.Changelog(*team, atc.PipelineRef{Name: *pipeline}, oldSnapshot, newSnapshot)
+	exitIfErr(err)
+
+	if *format == "json" {
+		output, err := json.MarshalIndent(changelog, "", "  ")
+		exitIfErr(err)
+		fmt.Println(string(output))
+		return
+	}
+
+	fmt.Print(changelog.Markdown())
+}
+
+// readVersionsFile reads a versions file, or stdin if path is -.
+func readVersionsFile(path string) (*stopover.Snapshot, error) {
+	data, err := readFileOrStdin(path)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot, err := stopover.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", path, err)
+	}
+
+	return snapshot, nil
+}
+
+// readFileOrStdin reads a file, or stdin if path is -.
+func readFileOrStdin(path string) ([]byte, error) {
+	if path == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+
+	return ioutil.ReadFile(path)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+	"github.com/concourse/concourse/go-concourse/concourse"
+)
+
+const ensureUsage = `Usage:
+$ export ATC_BEARER_TOKEN="eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.eyJj....."
+$ stopover ensure --url https://prod-ci.server.tld --team my-team --pipeline my-pipeline versions.yml
+
+Makes sure the target pipeline knows every version in the versions file,
+checking its resources from any that are missing.`
+
+func ensureCommand(args []string) {
+	flags := flag.NewFlagSet("stopover ensure", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	var targetFlags targetFlags
+	targetFlags.register(flags)
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 || !targetFlags.valid() || os.Getenv("ATC_BEARER_TOKEN") == "" {
+		printUsageAndExit(flags, ensureUsage, ExitFailure)
+	}
+
+	snapshot, err := readVersionsFile(flags.Arg(0))
+	exitIfErr(err)
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+
+	exitIfErr(ensureVersions(ctx, targetFlags.target(clientFlags.client(ctx, targetFlags.url)), snapshot, targetFlags.checkTimeout))
+}
+
+// targetFlags holds the flags naming the pipeline snapshots are applied to.
+type targetFlags struct {
+	url          string
+	team         string
+	pipeline     string
+	checkTimeout time.Duration
+}
+
+func (t *targetFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&t.url, "url", "", "URL of the ATC to apply to")
+	flags.StringVar(&t.team, "team", "", "team owning the pipeline")
+	flags.StringVar(&t.pipeline, "pipeline", "", "pipeline to apply to")
+	flags.DurationVar(&t.checkTimeout, "check-timeout", 5*time.Minute, "how long to wait for checks discovering missing versions")
+}
+
+func (t *targetFlags) valid() bool {
+	return t.url != "" && t.team != "" && t.pipeline != ""
+}
+
+func (t *targetFlags) target(client concourse.Client) *stopover.Target {
+	return stopover.NewTarget(client, t.team, atc.PipelineRef{Name: t.pipeline})
+}
+
+// ensureVersions makes sure the target knows every version in snapshot,
+// reporting what it did on stderr.
+func ensureVersions(ctx context.Context, target *stopover.Target, snapshot *stopover.Snapshot, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	results, err := target.EnsureVersions(ctx, snapshot)
+	for _, result := range results {
+		if result.CheckBuild != nil {
+			fmt.Fprintf(os.Stderr, "%s: discovered by check build %d\n", result.Entry.Key, result.CheckBuild.ID)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: already present\n", result.Entry.Key)
+		}
+	}
+
+	return err
+}
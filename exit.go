@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/EngineerBetter/stopover/pkg/policy"
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+)
+
+// Exit codes used by the CLI, one per failure mode. ExitFailure covers usage
+// errors and anything not otherwise classified.
+const (
+	ExitOK               = 0
+	ExitFailure          = 1
+	ExitTeamNotFound     = 3
+	ExitPipelineNotFound = 4
+	ExitJobNotFound      = 5
+	ExitBuildNotFound    = 6
+	ExitUnauthorized     = 7
+	ExitForbidden        = 8
+	ExitTransport        = 9
+	ExitInputMismatch    = 10
+	ExitBuildFailed      = 11
+	ExitBuildErrored     = 12
+	ExitBuildAborted     = 13
+	ExitDisabledVersion  = 14
+	ExitPolicyViolation  = 15
+	ExitNotPassed        = 16
+	ExitStale            = 17
+	ExitResourceNotFound = 18
+)
+
+// ExitCode maps an error returned by the stopover package to the exit code the
+// CLI should use.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, stopover.ErrTeamNotFound):
+		return ExitTeamNotFound
+	case errors.Is(err, stopover.ErrPipelineNotFound):
+		return ExitPipelineNotFound
+	case errors.Is(err, stopover.ErrJobNotFound):
+		return ExitJobNotFound
+	case errors.Is(err, stopover.ErrBuildNotFound):
+		return ExitBuildNotFound
+	case errors.Is(err, stopover.ErrResourceNotFound):
+		return ExitResourceNotFound
+	case errors.Is(err, stopover.ErrUnauthorized):
+		return ExitUnauthorized
+	case errors.Is(err, stopover.ErrForbidden):
+		return ExitForbidden
+	case errors.Is(err, stopover.ErrTransport):
+		return ExitTransport
+	case errors.Is(err, stopover.ErrInputMismatch):
+		return ExitInputMismatch
+	case errors.Is(err, stopover.ErrBuildFailed):
+		return ExitBuildFailed
+	case errors.Is(err, stopover.ErrBuildErrored):
+		return ExitBuildErrored
+	case errors.Is(err, stopover.ErrBuildAborted):
+		return ExitBuildAborted
+	case errors.Is(err, stopover.ErrDisabledVersion):
+		return ExitDisabledVersion
+	case errors.Is(err, stopover.ErrNotPassed):
+		return ExitNotPassed
+	case errors.Is(err, stopover.ErrStale):
+		return ExitStale
+	case errors.Is(err, policy.ErrViolation):
+		return ExitPolicyViolation
+	default:
+		return ExitFailure
+	}
+}
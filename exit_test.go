@@ -0,0 +1,45 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"errors"
+	"fmt"
+
+	"github.com/EngineerBetter/stopover/pkg/policy"
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+)
+
+var _ = Describe("ExitCode", func() {
+	It("maps each failure mode to its own exit code", func() {
+		expected := map[error]int{
+			stopover.ErrTeamNotFound:     ExitTeamNotFound,
+			stopover.ErrPipelineNotFound: ExitPipelineNotFound,
+			stopover.ErrJobNotFound:      ExitJobNotFound,
+			stopover.ErrBuildNotFound:    ExitBuildNotFound,
+			stopover.ErrResourceNotFound: ExitResourceNotFound,
+			stopover.ErrUnauthorized:     ExitUnauthorized,
+			stopover.ErrForbidden:        ExitForbidden,
+			stopover.ErrTransport:        ExitTransport,
+			stopover.ErrInputMismatch:    ExitInputMismatch,
+			stopover.ErrBuildFailed:      ExitBuildFailed,
+			stopover.ErrBuildErrored:     ExitBuildErrored,
+			stopover.ErrBuildAborted:     ExitBuildAborted,
+			stopover.ErrDisabledVersion:  ExitDisabledVersion,
+			stopover.ErrNotPassed:        ExitNotPassed,
+			stopover.ErrStale:            ExitStale,
+			policy.ErrViolation:          ExitPolicyViolation,
+			errors.New("boom"):           ExitFailure,
+		}
+
+		for err, code := range expected {
+			Ω(ExitCode(err)).Should(Equal(code), err.Error())
+			Ω(ExitCode(fmt.Errorf("wrapped: %w", err))).Should(Equal(code), err.Error())
+		}
+	})
+
+	It("is zero when there is no error", func() {
+		Ω(ExitCode(nil)).Should(Equal(ExitOK))
+	})
+})
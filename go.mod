@@ -6,11 +6,13 @@ replace github.com/dgrijalva/jwt-go => github.com/dgrijalva/jwt-go v2.6.1-0.2016
 
 require (
 	github.com/SpectoLabs/hoverfly v1.3.2
+	github.com/boltdb/bolt v1.2.1-0.20160424201119-d97499360d1e
 	github.com/concourse/concourse v1.6.1-0.20210527193308-09f694307bf4
+	github.com/google/uuid v1.2.0
 	github.com/onsi/ginkgo v1.16.2
 	github.com/onsi/gomega v1.12.0
-	github.com/pkg/errors v0.9.1
+	github.com/tedsuo/rata v1.0.1-0.20170830210128-07d200713958
+	github.com/xeipuuv/gojsonschema v0.0.0-20180618132009-1d523034197f
 	golang.org/x/oauth2 v0.0.0-20210427180440-81ed05c6b58c
 	gopkg.in/yaml.v2 v2.4.0
-
 )
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/history"
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+const historyUsage = `Usage:
+$ stopover history list [--team T] [--pipeline P] [--job J] [--since TIME] [--until TIME]
+$ stopover history show ID
+$ stopover history show --job J --at TIME
+$ stopover history find-version [--resource NAME] FIELD=VALUE...
+
+TIME is RFC3339 (2006-01-02T15:04:05Z) or a date (2006-01-02). Commit SHAs
+and digests given to find-version may be abbreviated.`
+
+func defaultHistoryPath() string {
+	if path := os.Getenv("STOPOVER_HISTORY"); path != "" {
+		return path
+	}
+
+	return "stopover-history.db"
+}
+
+func recordHistory(path string, snapshot *stopover.Snapshot) error {
+	store, err := history.Open(path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	_, err = store.Add(snapshot)
+	return err
+}
+
+func historyCommand(args []string) {
+	flags := flag.NewFlagSet("stopover history", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	dbPath := flags.String("db", defaultHistoryPath(), "history store path (defaults to $STOPOVER_HISTORY)")
+	team := flags.String("team", "", "only snapshots of this team")
+	pipeline := flags.String("pipeline", "", "only snapshots of this pipeline")
+	job := flags.String("job", "", "only snapshots of this job")
+	since := flags.String("since", "", "only snapshots generated at or after this time")
+	until := flags.String("until", "", "only snapshots generated at or before this time")
+	at := flags.String("at", "", "show: the latest snapshot generated at or before this time")
+	resource := flags.String("resource", "", "find-version: only match versions of this resource")
+
+	if len(args) == 0 {
+		printUsageAndExit(flags, historyUsage, ExitFailure)
+	}
+
+	subcommand := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		printUsageAndExit(flags, historyUsage, ExitFailure)
+	}
+
+	query := history.Query{Team: *team, Pipeline: *pipeline, Job: *job}
+	var err error
+	query.Since, err = parseTime(*since, false)
+	exitIfErr(err)
+	query.Until, err = parseTime(*until, true)
+	exitIfErr(err)
+
+	// Everything is checked before the store is opened, as opening it creates
+	// it, so that a mistyped command does not leave an empty store behind.
+	var id uint64
+	switch {
+	case subcommand == "list" && flags.NArg() == 0:
+
+	case subcommand == "show" && flags.NArg() == 1:
+		id, err = strconv.ParseUint(flags.Arg(0), 10, 64)
+		exitIfErr(err)
+
+	case subcommand == "show" && flags.NArg() == 0 && *at != "":
+		query.Until, err = parseTime(*at, true)
+		exitIfErr(err)
+
+	case subcommand == "find-version" && flags.NArg() > 0:
+		query.Resource = *resource
+		query.Version, err = parseVersion(flags.Args())
+		exitIfErr(err)
+
+	default:
+		printUsageAndExit(flags, historyUsage, ExitFailure)
+	}
+
+	store, err := history.Open(*dbPath)
+	exitIfErr(err)
+	defer store.Close()
+
+	switch {
+	case subcommand == "show" && flags.NArg() == 1:
+		record, found, err := store.Get(id)
+		exitIfErr(err)
+		if !found {
+			exitIfErr(fmt.Errorf("snapshot %d not found", id))
+		}
+		exitIfErr(printRecord(os.Stdout, record))
+
+	case subcommand == "show":
+		record, found, err := store.Latest(query)
+		exitIfErr(err)
+		if !found {
+			exitIfErr(fmt.Errorf("no snapshot found at or before %s", *at))
+		}
+		exitIfErr(printRecord(os.Stdout, record))
+
+	default:
+		records, err := store.Find(query)
+		exitIfErr(err)
+		printRecords(os.Stdout, records)
+	}
+}
+
+func printRecords(w io.Writer, records []history.Record) {
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tGENERATED\tTEAM\tPIPELINE\tJOB\tBUILD\tENTRIES")
+	for _, record := range records {
+		source := record.Snapshot.Source
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%s\t%s\t%d\n",
+			record.ID,
+			record.Snapshot.GeneratedAt.Format(time.RFC3339),
+			source.Team,
+			source.PipelineRef().String(),
+			source.Job,
+			source.Build,
+			len(record.Snapshot.Entries),
+		)
+	}
+	table.Flush()
+}
+
+func printRecord(w io.Writer, record history.Record) error {
+	source := record.Snapshot.Source
+	fmt.Fprintf(w, "# snapshot %d of %s/%s/%s build %s, generated %s\n",
+		record.ID,
+		source.Team,
+		source.PipelineRef().String(),
+		source.Job,
+		source.Build,
+		record.Snapshot.GeneratedAt.Format(time.RFC3339),
+	)
+
+	yaml, err := stopover.Marshal(record.Snapshot)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(yaml)
+	return err
+}
+
+// parseTime parses RFC3339 times or dates. Dates are taken as the start of the
+// day, or its end if endOfDay is set, in local time.
+func parseTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use RFC3339 or YYYY-MM-DD", value)
+	}
+
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	return t, nil
+}
+
+// parseVersion turns FIELD=VALUE arguments into a version.
+func parseVersion(args []string) (atc.Version, error) {
+	version := atc.Version{}
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid version field %q: expected FIELD=VALUE", arg)
+		}
+		version[parts[0]] = parts[1]
+	}
+
+	return version, nil
+}
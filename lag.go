@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+const lagUsage = `Usage:
+$ export ATC_BEARER_TOKEN="eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.eyJj....."
+$ stopover lag [--url https://ci.server.tld --team my-team --pipeline my-pipeline] [--max-behind 5] [--max-age 30d] [--format table|json] versions.yml
+
+Reports how many newer enabled versions of each resource exist than the one
+in the versions file, and how old that version is. The pipeline defaults to
+the one in the versions file's header. Exits non-zero if any version is
+beyond a threshold.`
+
+// lagRow is a resource's lag as reported by the lag command.
+type lagRow struct {
+	Key     string      `json:"key"`
+	Version atc.Version `json:"version"`
+	Found   bool        `json:"found"`
+	Behind  int         `json:"behind"`
+	Latest  atc.Version `json:"latest,omitempty"`
+	Created *time.Time  `json:"created,omitempty"`
+	AgeDays *int        `json:"age_days,omitempty"`
+	Stale   bool        `json:"stale"`
+}
+
+func lagCommand(args []string) {
+	flags := flag.NewFlagSet("stopover lag", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	url := flags.String("url", "", "ATC URL, if not the one in the versions file's header")
+	team := flags.String("team", "", "team owning the pipeline, if not the one in the header")
+	pipeline := flags.String("pipeline", "", "pipeline to compare against, if not the one in the header")
+	maxBehind := flags.Int("max-behind", -1, "flag versions more than this many versions behind (-1 for no limit)")
+	maxAgeFlag := flags.String("max-age", "", "flag versions older than this, e.g. 30d or 12h")
+	format := flags.String("format", "table", "output format: table or json")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 || os.Getenv("ATC_BEARER_TOKEN") == "" {
+		printUsageAndExit(flags, lagUsage, ExitFailure)
+	}
+
+	if *format != "table" && *format != "json" {
+		printUsageAndExit(flags, lagUsage, ExitFailure)
+	}
+
+	maxAge, err := parseAge(*maxAgeFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		printUsageAndExit(flags, lagUsage, ExitFailure)
+	}
+
+	snapshot, err := readVersionsFile(flags.Arg(0))
+	exitIfErr(err)
+
+	pipelineRef := snapshot.Source.PipelineRef()
+	if *pipeline != "" {
+		pipelineRef = atc.PipelineRef{Name: *pipeline}
+	}
+	if *url == "" {
+		*url = snapshot.Source.URL
+	}
+	if *team == "" {
+		*team = snapshot.Source.Team
+	}
+	if *url == "" || *team == "" || pipelineRef.Name == "" {
+		fmt.Fprintln(os.Stderr, "--url, --team and --pipeline are required for versions files without a header")
+		printUsageAndExit(flags, lagUsage, ExitFailure)
+	}
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+	target := stopover.NewTarget(clientFlags.client(ctx, *url), *team, pipelineRef)
+
+	lags, err := target.Lag(snapshot)
+	exitIfErr(err)
+
+	now := time.Now()
+	var rows []lagRow
+	var stale []stopover.Lag
+	for _, lag := range lags {
+		row := lagRow{
+			Key:     lag.Entry.Key,
+			Version: lag.Entry.Version,
+			Found:   lag.Found,
+			Behind:  lag.Behind,
+			Latest:  lag.Latest,
+			Stale:   lag.Stale(*maxBehind, maxAge, now),
+		}
+		if !lag.Created.IsZero() {
+			created := lag.Created.UTC()
+			days := int(lag.Age(now).Hours() / 24)
+			row.Created, row.AgeDays = &created, &days
+		}
+		if row.Stale {
+			stale = append(stale, lag)
+		}
+		rows = append(rows, row)
+	}
+
+	if *format == "json" {
+		if rows == nil {
+			rows = []lagRow{}
+		}
+		output, err := json.MarshalIndent(rows, "", "  ")
+		exitIfErr(err)
+		fmt.Println(string(output))
+	} else {
+		printLag(os.Stdout, rows)
+	}
+
+	exitIfErr(stopover.StaleError(stale))
+}
+
+func printLag(w io.Writer, rows []lagRow) {
+	table := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(table, "KEY\tBEHIND\tAGE\tLATEST\tSTALE")
+	for _, row := range rows {
+		behind, age, stale := strconv.Itoa(row.Behind), "-", ""
+		if !row.Found {
+			behind = "unknown version"
+		}
+		if row.AgeDays != nil {
+			age = strconv.Itoa(*row.AgeDays) + "d"
+		}
+		if row.Stale {
+			stale = "yes"
+		}
+
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", row.Key, behind, age, formatLatest(row.Latest), stale)
+	}
+	table.Flush()
+}
+
+func formatLatest(version atc.Version) string {
+	if version == nil {
+		return "-"
+	}
+
+	output, _ := json.Marshal(version)
+	return string(output)
+}
+
+// parseAge parses a duration, also accepting a whole number of days such as
+// 30d. An empty string is no duration.
+func parseAge(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	age, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return age, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+)
+
+var _ = Describe("parseAge", func() {
+	It("accepts days as well as durations", func() {
+		for value, expected := range map[string]time.Duration{
+			"":    0,
+			"30d": 30 * 24 * time.Hour,
+			"12h": 12 * time.Hour,
+		} {
+			age, err := parseAge(value)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(age).Should(Equal(expected), value)
+		}
+	})
+
+	It("rejects anything else", func() {
+		for _, value := range []string{"d", "-1d", "month", "3w"} {
+			_, err := parseAge(value)
+			Ω(err).Should(MatchError(ContainSubstring("invalid age")), value)
+		}
+	})
+})
@@ -1,39 +1,323 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
 
+	"github.com/EngineerBetter/stopover/pkg/provenance"
+	"github.com/EngineerBetter/stopover/pkg/sbom"
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/EngineerBetter/stopover/pkg/templates"
 	"github.com/concourse/concourse/atc"
 	"github.com/concourse/concourse/go-concourse/concourse"
-	"github.com/pkg/errors"
 	"golang.org/x/oauth2"
-	"gopkg.in/yaml.v2"
 )
 
+// version is the version of stopover recorded in versions file headers, set
+// at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+var commands = map[string]func(args []string){
+	"apply":         applyCommand,
+	"changelog":     changelogCommand,
+	"check-policy":  checkPolicyCommand,
+	"ensure":        ensureCommand,
+	"history":       historyCommand,
+	"lag":           lagCommand,
+	"merge":         mergeCommand,
+	"serve":         serveCommand,
+	"validate":      validateCommand,
+	"verify-passed": verifyPassedCommand,
+	"watch":         watchCommand,
+}
+
 func main() {
-	if len(os.Args) != 6 || os.Getenv("ATC_BEARER_TOKEN") == "" {
-		printUsageAndExit(1)
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
 	}
 
-	bearerToken := os.Getenv("ATC_BEARER_TOKEN")
-	url := os.Args[1]
-	team := os.Args[2]
-	pipeline := os.Args[3]
-	job := os.Args[4]
-	build := os.Args[5]
+	snapshotCommand(os.Args[1:])
+}
+
+func snapshotCommand(args []string) {
+	flags := flag.NewFlagSet("stopover", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	var snapshotFlags snapshotFlags
+	snapshotFlags.register(flags)
+	historyPath := flags.String("history", "", "record the snapshot in the history store at this path")
+	format := flags.String("format", "yaml", "output format: yaml, cyclonedx, spdx or provenance")
+	signKey := flags.String("sign-key", "", "PEM private key to sign provenance with, wrapping it in a DSSE envelope")
+	templatePath := flags.String("template", "", "render the snapshot through this Go text/template rather than printing the versions file")
+	allowDisabled := flags.Bool("allow-disabled", false, "warn about disabled versions rather than failing")
+	header := flags.Bool("header", false, "head the versions file with the build it came from and the schema version")
+	var publishFlags publishFlags
+	publishFlags.register(flags)
+
+	if err := flags.Parse(args); err != nil || os.Getenv("ATC_BEARER_TOKEN") == "" {
+		printUsageAndExit(flags, snapshotUsage, ExitFailure)
+	}
+
+	url, ref, err := parseBuildArgs(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		printUsageAndExit(flags, snapshotUsage, ExitFailure)
+	}
+
+	switch *format {
+	case "yaml", "cyclonedx", "spdx":
+	case "provenance":
+		// Outputs are the provenance's subjects.
+		snapshotFlags.includeOutputs = true
+	default:
+		printUsageAndExit(flags, snapshotUsage, ExitFailure)
+	}
 
-	client := NewClient(url, bearerToken, true)
-	resourceVersions, err := GetResourceVersions(client, team, pipeline, job, build)
+	var tmpl *template.Template
+	if *templatePath != "" {
+		if *format != "yaml" {
+			fmt.Fprintln(os.Stderr, "--template cannot be combined with --format")
+			printUsageAndExit(flags, snapshotUsage, ExitFailure)
+		}
+
+		tmpl, err = readTemplate(*templatePath)
+		exitIfErr(err)
+	}
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+	client := clientFlags.client(ctx, url)
+
+	snapshotter := snapshotFlags.snapshotter(client)
+	snapshot, err := snapshotter.Snapshot(ref)
+	exitIfErr(err)
+	disabled, unknown, err := snapshotter.DisabledVersions(snapshot)
 	exitIfErr(err)
-	yaml, err := GenerateYaml(resourceVersions)
+	warnUnchecked(unknown)
+	exitIfErr(checkDisabled(disabled, *allowDisabled))
+	var yaml []byte
+	if *header {
+		yaml, err = stopover.MarshalWithHeader(snapshot, stopover.NewHeader(snapshot, version))
+	} else {
+		yaml, err = stopover.Marshal(snapshot)
+	}
 	exitIfErr(err)
-	fmt.Print(string(yaml))
+
+	exitIfErr(publishFlags.publish(ctx, snapshot, yaml))
+
+	// History is only recorded once publishing has succeeded, so that a rerun
+	// after a failed publish does not record the build twice.
+	if *historyPath != "" {
+		exitIfErr(recordHistory(*historyPath, snapshot))
+	}
+
+	if tmpl != nil {
+		output, err := templates.Render(tmpl, snapshot)
+		exitIfErr(err)
+		fmt.Print(string(output))
+		return
+	}
+
+	if *format == "yaml" {
+		fmt.Print(string(yaml))
+		return
+	}
+
+	output, err := render(snapshotter, snapshot, *format, *signKey)
+	exitIfErr(err)
+	fmt.Println(string(output))
+}
+
+// parseBuildArgs accepts the ATC URL followed by the team, pipeline, job and
+// build names, the ATC URL followed by a global build ID, or the URL of the
+// build's page in the web UI.
+func parseBuildArgs(args []string) (string, stopover.BuildRef, error) {
+	switch len(args) {
+	case 1:
+		return stopover.ParseBuildURL(args[0])
+	case 2:
+		id, err := strconv.Atoi(args[1])
+		if err != nil || id <= 0 {
+			return "", stopover.BuildRef{}, fmt.Errorf("invalid global build ID %q", args[1])
+		}
+		return args[0], stopover.BuildRef{ID: id}, nil
+	case 5:
+		return args[0], stopover.BuildRef{
+			Team:     args[1],
+			Pipeline: atc.PipelineRef{Name: args[2]},
+			Job:      args[3],
+			Build:    args[4],
+		}, nil
+	default:
+		return "", stopover.BuildRef{}, errors.New("expected a build URL, an ATC URL and global build ID, or an ATC URL, team, pipeline, job and build")
+	}
 }
 
-func NewClient(url, bearerToken string, ignoreTls bool) concourse.Client {
+// readTemplate parses the template at path, named after the file so that
+// errors point to it.
+func readTemplate(path string) (*template.Template, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return templates.Parse(filepath.Base(path), string(text))
+}
+
+// render renders a snapshot as a bill of materials or provenance, looking up
+// the type and source of each resource in the pipeline config.
+func render(snapshotter *stopover.Snapshotter, snapshot *stopover.Snapshot, format, signKey string) ([]byte, error) {
+	// One-off builds have no pipeline config, so their components are given
+	// generic identifiers.
+	var config atc.Config
+	if snapshot.Source.Pipeline != "" {
+		var err error
+		config, err = snapshotter.PipelineConfig(snapshot.Source.Team, snapshot.Source.PipelineRef())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch format {
+	case "spdx":
+		return sbom.SPDX(snapshot, sbom.Components(snapshot, config))
+	case "cyclonedx":
+		return sbom.CycloneDX(snapshot, sbom.Components(snapshot, config))
+	}
+
+	plan, err := snapshotter.BuildPlan(snapshot.Source.BuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []provenance.Option
+	if snapshotter.Complete() {
+		opts = append(opts, provenance.WithCompleteMaterials())
+	}
+
+	statement := provenance.New(snapshot, config, plan, opts...)
+	if signKey == "" {
+		return provenance.Marshal(statement)
+	}
+
+	keyPEM, err := ioutil.ReadFile(signKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := provenance.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, err := provenance.Sign(statement, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(envelope, "", "  ")
+}
+
+// snapshotFlags holds the flags controlling what a snapshot contains, shared
+// by every command that takes snapshots.
+type snapshotFlags struct {
+	includeOutputs bool
+	includeTypes   bool
+	stepNames      bool
+	taskImages     bool
+	include        string
+	exclude        string
+}
+
+func (s *snapshotFlags) register(flags *flag.FlagSet) {
+	flags.BoolVar(&s.includeOutputs, "include-outputs", false, "also record the versions the build produced, as output_version_<name>")
+	flags.BoolVar(&s.includeTypes, "include-resource-types", false, "also record the versions of custom resource types, as resource_type_version_<name>")
+	flags.BoolVar(&s.stepNames, "step-names", false, "name inputs after their get steps rather than the resources they fetch")
+	flags.BoolVar(&s.taskImages, "include-task-images", false, "also record the image each task ran with, as task_image_version_<task>")
+	flags.StringVar(&s.include, "include", "", "comma-separated resource name patterns to include")
+	flags.StringVar(&s.exclude, "exclude", "", "comma-separated resource name patterns to exclude")
+}
+
+func (s *snapshotFlags) snapshotter(client concourse.Client) *stopover.Snapshotter {
+	opts := []stopover.Option{stopover.WithClient(client)}
+	if s.includeOutputs {
+		opts = append(opts, stopover.WithOutputs())
+	}
+	if s.includeTypes {
+		opts = append(opts, stopover.WithResourceTypes())
+	}
+	if s.stepNames {
+		opts = append(opts, stopover.WithStepNames())
+	}
+	if s.taskImages {
+		opts = append(opts, stopover.WithTaskImages())
+	}
+	if s.include != "" {
+		opts = append(opts, stopover.WithFilter(stopover.Include(strings.Split(s.include, ",")...)))
+	}
+	if s.exclude != "" {
+		opts = append(opts, stopover.WithFilter(stopover.Exclude(strings.Split(s.exclude, ",")...)))
+	}
+
+	return stopover.NewSnapshotter(opts...)
+}
+
+// clientFlags holds the flags controlling requests to the ATC, shared by every
+// command that talks to one.
+type clientFlags struct {
+	config   ClientConfig
+	deadline time.Duration
+}
+
+func (c *clientFlags) register(flags *flag.FlagSet) {
+	c.config = DefaultClientConfig
+	flags.DurationVar(&c.config.Timeout, "timeout", c.config.Timeout, "timeout for each request to the ATC")
+	flags.IntVar(&c.config.Retries, "retries", c.config.Retries, "retries for GET requests failing with a connection error or 5xx")
+	flags.DurationVar(&c.config.Backoff, "retry-backoff", c.config.Backoff, "delay before the first retry, doubling thereafter")
+	flags.DurationVar(&c.deadline, "deadline", 0, "overall deadline for the command (0 for none)")
+}
+
+// client returns a client for the ATC at url using ATC_BEARER_TOKEN, whose
+// requests are bound to ctx.
+func (c *clientFlags) client(ctx context.Context, url string) concourse.Client {
+	return NewClient(ctx, url, os.Getenv("ATC_BEARER_TOKEN"), true, c.config)
+}
+
+// context returns a context cancelled on SIGINT or SIGTERM, or once the
+// deadline passes.
+func (c *clientFlags) context() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if c.deadline <= 0 {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.deadline)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// NewClient returns a concourse.Client authenticating with bearerToken. Every
+// request is bound to ctx and is timed out and retried according to config.
+func NewClient(ctx context.Context, url, bearerToken string, ignoreTls bool, config ClientConfig) concourse.Client {
 	// Initialise the default client before modifying its Transport in place
 	// Panic occurs if this isn't done
 	var tracing = false
@@ -42,6 +326,11 @@ func NewClient(url, bearerToken string, ignoreTls bool) concourse.Client {
 	tr := http.DefaultTransport.(*http.Transport)
 	tr.TLSClientConfig.InsecureSkipVerify = ignoreTls
 
+	var base http.RoundTripper = tr
+	if config.Metrics != nil {
+		base = config.Metrics.Transport(tr)
+	}
+
 	oAuthToken := &oauth2.Token{
 		AccessToken: bearerToken,
 		TokenType:   "Bearer",
@@ -49,7 +338,11 @@ func NewClient(url, bearerToken string, ignoreTls bool) concourse.Client {
 
 	transport := &oauth2.Transport{
 		Source: oauth2.StaticTokenSource(oAuthToken),
-		Base:   tr,
+		Base: &retryTransport{
+			ctx:    ctx,
+			base:   base,
+			config: config,
+		},
 	}
 
 	httpClient := &http.Client{Transport: transport}
@@ -57,54 +350,44 @@ func NewClient(url, bearerToken string, ignoreTls bool) concourse.Client {
 	return concourse.NewClient(url, httpClient, tracing)
 }
 
-func GetResourceVersions(client concourse.Client, teamName, pipelineName, jobName, buildName string) (map[string]atc.Version, error) {
-	team := client.Team(teamName)
-	pipelineRef := atc.PipelineRef{
-		Name: pipelineName,
-	}
-
-	build, found, err := team.JobBuild(pipelineRef, jobName, buildName)
-
-	if err != nil {
-		return nil, fmt.Errorf("error getting build for job [%v]", err)
-	}
-
-	if !found {
-		return nil, errors.New("did not find build for job")
-	}
-
-	globalID := build.ID
-	buildInputsOutputs, found, err := client.BuildResources(globalID)
-
-	if !found || err != nil {
-		return nil, errors.New("could not get resources for build with global ID " + strconv.Itoa(globalID))
-	}
-
-	resourceVersions := make(map[string]atc.Version)
-	for _, input := range buildInputsOutputs.Inputs {
-		key := "resource_version_" + input.Name
-		resourceVersions[key] = input.Version
+// checkDisabled fails if a snapshot contains disabled versions, or just warns
+// when they are allowed.
+func checkDisabled(disabled []stopover.Entry, allow bool) error {
+	err := stopover.DisabledError(disabled)
+	if err != nil && allow {
+		fmt.Fprintln(os.Stderr, "warning:", err)
+		return nil
 	}
 
-	return resourceVersions, nil
+	return err
 }
 
-func GenerateYaml(resourceVersions map[string]atc.Version) ([]byte, error) {
-	return yaml.Marshal(resourceVersions)
+// warnUnchecked warns about entries that were not checked for disabled
+// versions because the pipeline does not know their resources.
+func warnUnchecked(unknown []stopover.Entry) {
+	for _, entry := range unknown {
+		fmt.Fprintf(os.Stderr, "warning: not checking whether %s is disabled: resource %q not found in pipeline\n", entry.Key, entry.Name)
+	}
 }
 
 func exitIfErr(err error) {
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(ExitCode(err))
 	}
 }
 
-func printUsageAndExit(status int) {
-	usage := `** Error: arguments not found
+const snapshotUsage = `** Error: arguments not found
 Usage:
 $ export ATC_BEARER_TOKEN="eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.eyJj....."
-$ stopover https://ci.server.tld my-team my-pipeline my-job job-build-id`
+$ stopover https://ci.server.tld my-team my-pipeline my-job job-build-id
+$ stopover https://ci.server.tld global-build-id
+$ stopover https://ci.server.tld/teams/my-team/pipelines/my-pipeline/jobs/my-job/builds/job-build-id`
+
+func printUsageAndExit(flags *flag.FlagSet, usage string, status int) {
 	fmt.Fprintln(os.Stderr, usage)
+	fmt.Fprintln(os.Stderr, "\nFlags:")
+	flags.SetOutput(os.Stderr)
+	flags.PrintDefaults()
 	os.Exit(status)
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+)
+
+const mergeUsage = `Usage:
+$ stopover merge base-versions.yml [override-versions.yml...] [--set resource_version_my-repo.ref=abc123...] [--allow-new]
+
+Merges versions files, with later files taking precedence over earlier ones
+and --set over all files, and prints the result. Each --set for a key makes
+up part of its new version, replacing the whole version. The base file's
+header, if it has one, is kept. Entries changed are reported on stderr.`
+
+// stringsFlag collects the values of a flag that may be given many times.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func mergeCommand(args []string) {
+	flags := flag.NewFlagSet("stopover merge", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	var sets stringsFlag
+	flags.Var(&sets, "set", "override a version field, as KEY.FIELD=VALUE; may be repeated")
+	allowNew := flags.Bool("allow-new", false, "allow keys that are not in the base versions file")
+
+	// Flags may follow the files being merged.
+	var paths []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			printUsageAndExit(flags, mergeUsage, ExitFailure)
+		}
+
+		if flags.NArg() == 0 {
+			break
+		}
+
+		paths = append(paths, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+
+	if len(paths) == 0 {
+		printUsageAndExit(flags, mergeUsage, ExitFailure)
+	}
+
+	merged, err := readVersionsFile(paths[0])
+	exitIfErr(err)
+
+	var overrides []stopover.Override
+	merge := func(overlay *stopover.Snapshot, from string) {
+		var changed []stopover.Override
+		merged, changed, err = stopover.Merge(merged, overlay, from, *allowNew)
+		if err != nil {
+			exitIfErr(fmt.Errorf("%v; pass --allow-new to add it", err))
+		}
+		overrides = append(overrides, changed...)
+	}
+
+	for _, path := range paths[1:] {
+		overlay, err := readVersionsFile(path)
+		exitIfErr(err)
+		merge(overlay, path)
+	}
+
+	if len(sets) > 0 {
+		overlay, err := stopover.ParseSets(sets)
+		exitIfErr(err)
+		merge(overlay, "--set")
+	}
+
+	for _, override := range overrides {
+		fmt.Fprintln(os.Stderr, override)
+	}
+
+	var output []byte
+	if merged.Header != nil {
+		output, err = stopover.MarshalWithHeader(merged, *merged.Header)
+	} else {
+		output, err = stopover.Marshal(merged)
+	}
+	exitIfErr(err)
+	fmt.Print(string(output))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const verifyPassedUsage = `Usage:
+$ export ATC_BEARER_TOKEN="eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.eyJj....."
+$ stopover verify-passed --url https://ci.server.tld --team my-team --pipeline my-pipeline --require test-job,security-scan versions.yml
+
+Checks that a succeeded build of each required job used every version in the
+versions file, listing the builds that did and any versions that have not
+passed. Jobs are only required of the resources they get.`
+
+func verifyPassedCommand(args []string) {
+	flags := flag.NewFlagSet("stopover verify-passed", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	var targetFlags targetFlags
+	targetFlags.register(flags)
+	require := flags.String("require", "", "comma-separated jobs every version must have passed")
+
+	err := flags.Parse(args)
+	jobs := splitList(*require)
+	if err != nil || flags.NArg() != 1 || !targetFlags.valid() || len(jobs) == 0 || os.Getenv("ATC_BEARER_TOKEN") == "" {
+		printUsageAndExit(flags, verifyPassedUsage, ExitFailure)
+	}
+
+	snapshot, err := readVersionsFile(flags.Arg(0))
+	exitIfErr(err)
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+	target := targetFlags.target(clientFlags.client(ctx, targetFlags.url))
+
+	results, err := target.VerifyPassed(snapshot, jobs)
+	for _, result := range results {
+		fmt.Println(result)
+	}
+	exitIfErr(err)
+}
+
+// splitList splits a comma-separated flag value, trimming whitespace around
+// each element and dropping empty ones.
+func splitList(value string) []string {
+	var elements []string
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+
+	return elements
+}
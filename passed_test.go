@@ -0,0 +1,19 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("splitList", func() {
+	It("trims elements and drops empty ones", func() {
+		for value, expected := range map[string][]string{
+			"test,security-scan":      {"test", "security-scan"},
+			" test , security-scan ,": {"test", "security-scan"},
+			", ,":                     nil,
+			"":                        nil,
+		} {
+			Ω(splitList(value)).Should(Equal(expected), value)
+		}
+	})
+})
@@ -0,0 +1,503 @@
+// Package fakeatc is an in-memory stand-in for the parts of the Concourse ATC
+// API that stopover uses, for tests that exercise the real client over HTTP.
+package fakeatc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/concourse/concourse/atc"
+	"github.com/concourse/concourse/go-concourse/concourse"
+	"github.com/tedsuo/rata"
+	"golang.org/x/oauth2"
+)
+
+// Token is the bearer token the fake ATC accepts.
+const Token = "fake-atc-token"
+
+type jobKey struct {
+	team, pipeline, job string
+}
+
+type pipelineKey struct {
+	team, pipeline string
+}
+
+type resourceVersion struct {
+	team, pipeline, resource string
+	atc.ResourceVersion
+}
+
+// ATC is a fake ATC serving builds and their resources from memory.
+type ATC struct {
+	server *httptest.Server
+
+	mu        sync.Mutex
+	nextID    int
+	builds    []atc.Build
+	resources map[int]atc.BuildInputsOutputs
+	plans     map[int]atc.PublicBuildPlan
+	versions  []resourceVersion
+	configs   map[pipelineKey]atc.Config
+	jobs      map[jobKey]bool
+	requests  map[string]int
+}
+
+// New starts a fake ATC. Callers must Close it.
+func New() *ATC {
+	fake := &ATC{
+		nextID:    1,
+		resources: map[int]atc.BuildInputsOutputs{},
+		plans:     map[int]atc.PublicBuildPlan{},
+		configs:   map[pipelineKey]atc.Config{},
+		jobs:      map[jobKey]bool{},
+		requests:  map[string]int{},
+	}
+
+	implemented := rata.Handlers{
+		atc.ListPipelines:                http.HandlerFunc(fake.listPipelines),
+		atc.GetPipeline:                  http.HandlerFunc(fake.getPipeline),
+		atc.GetJob:                       http.HandlerFunc(fake.getJob),
+		atc.GetJobBuild:                  http.HandlerFunc(fake.getJobBuild),
+		atc.ListJobBuilds:                http.HandlerFunc(fake.listJobBuilds),
+		atc.GetBuild:                     http.HandlerFunc(fake.getBuild),
+		atc.BuildResources:               http.HandlerFunc(fake.buildResources),
+		atc.GetBuildPlan:                 http.HandlerFunc(fake.getBuildPlan),
+		atc.ListResourceVersions:         http.HandlerFunc(fake.listResourceVersions),
+		atc.GetConfig:                    http.HandlerFunc(fake.getConfig),
+		atc.ListBuildsWithVersionAsInput: http.HandlerFunc(fake.listBuildsWithVersionAsInput),
+	}
+
+	handlers := rata.Handlers{}
+	for _, route := range atc.Routes {
+		handler, found := implemented[route.Name]
+		if !found {
+			handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotImplemented)
+			})
+		}
+		handlers[route.Name] = fake.count(route.Name, handler)
+	}
+
+	router, err := rata.NewRouter(atc.Routes, handlers)
+	if err != nil {
+		panic(err)
+	}
+
+	fake.server = httptest.NewServer(router)
+	return fake
+}
+
+func (fake *ATC) URL() string {
+	return fake.server.URL
+}
+
+func (fake *ATC) Close() {
+	fake.server.Close()
+}
+
+// Client returns a real concourse.Client authenticated against the fake.
+func (fake *ATC) Client() concourse.Client {
+	httpClient := &http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: Token, TokenType: "Bearer"}),
+		},
+	}
+
+	return concourse.NewClient(fake.server.URL, httpClient, false)
+}
+
+// AddBuild records a job build and the resources it used, assigning it the
+// next global ID. The build's team, pipeline and job are created as needed.
+// Its plan gets each input with a step named after the resource; see
+// SetBuildPlan.
+func (fake *ATC) AddBuild(build atc.Build, resources atc.BuildInputsOutputs) atc.Build {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	build.ID = fake.nextID
+	fake.nextID++
+	if build.APIURL == "" {
+		build.APIURL = "/api/v1/builds/" + strconv.Itoa(build.ID)
+	}
+
+	fake.builds = append(fake.builds, build)
+	fake.resources[build.ID] = resources
+	fake.plans[build.ID] = getPlan(resources.Inputs)
+	fake.jobs[jobKey{build.TeamName, build.PipelineName, build.JobName}] = true
+
+	for _, input := range resources.Inputs {
+		fake.addVersion(build.TeamName, build.PipelineName, input.Name, input.Version)
+	}
+	for _, output := range resources.Outputs {
+		fake.addVersion(build.TeamName, build.PipelineName, output.Name, output.Version)
+	}
+
+	return build
+}
+
+func (fake *ATC) addVersion(team, pipeline, resource string, version atc.Version) {
+	if fake.findVersion(team, pipeline, resource, version) != nil {
+		return
+	}
+
+	fake.versions = append(fake.versions, resourceVersion{
+		team:            team,
+		pipeline:        pipeline,
+		resource:        resource,
+		ResourceVersion: atc.ResourceVersion{ID: len(fake.versions) + 1, Version: version, Enabled: true},
+	})
+}
+
+func (fake *ATC) findVersion(team, pipeline, resource string, version atc.Version) *resourceVersion {
+	for i, v := range fake.versions {
+		if v.team == team && v.pipeline == pipeline && v.resource == resource && reflect.DeepEqual(v.Version, version) {
+			return &fake.versions[i]
+		}
+	}
+
+	return nil
+}
+
+// DisableVersion disables a version of a resource used or produced by a
+// previously added build, as if done in the web UI.
+func (fake *ATC) DisableVersion(team, pipeline, resource string, version atc.Version) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if v := fake.findVersion(team, pipeline, resource, version); v != nil {
+		v.Enabled = false
+	}
+}
+
+// SetVersionMetadata sets the metadata of a version of a resource used or
+// produced by a previously added build.
+func (fake *ATC) SetVersionMetadata(team, pipeline, resource string, version atc.Version, metadata []atc.MetadataField) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if v := fake.findVersion(team, pipeline, resource, version); v != nil {
+		v.Metadata = metadata
+	}
+}
+
+// SetPipelineConfig sets the config of a pipeline, which is otherwise not
+// found.
+func (fake *ATC) SetPipelineConfig(team, pipeline string, config atc.Config) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.configs[pipelineKey{team, pipeline}] = config
+}
+
+// SetBuildPlan replaces the plan of a previously added build, e.g. to alias
+// its get steps.
+func (fake *ATC) SetBuildPlan(id int, plan atc.PublicBuildPlan) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.plans[id] = plan
+}
+
+func getPlan(inputs []atc.PublicBuildInput) atc.PublicBuildPlan {
+	steps := []atc.Plan{}
+	for i, input := range inputs {
+		steps = append(steps, atc.Plan{
+			ID:  atc.PlanID(strconv.Itoa(i + 2)),
+			Get: &atc.GetPlan{Name: input.Name, Resource: input.Name},
+		})
+	}
+
+	plan := atc.Plan{ID: "1", Do: (*atc.DoPlan)(&steps)}
+	return atc.PublicBuildPlan{Schema: "exec.v2", Plan: plan.Public()}
+}
+
+// SetBuildStatus updates the status of a previously added build.
+func (fake *ATC) SetBuildStatus(id int, status atc.BuildStatus) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	for i := range fake.builds {
+		if fake.builds[i].ID == id {
+			fake.builds[i].Status = status
+		}
+	}
+}
+
+// Requests returns how many requests were made to the named atc route, e.g.
+// atc.BuildResources.
+func (fake *ATC) Requests(route string) int {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return fake.requests[route]
+}
+
+func (fake *ATC) count(route string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+Token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		fake.mu.Lock()
+		fake.requests[route]++
+		fake.mu.Unlock()
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (fake *ATC) listPipelines(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	team := rata.Param(r, "team_name")
+	seen := map[string]bool{}
+	pipelines := []atc.Pipeline{}
+	for key := range fake.jobs {
+		if key.team == team && !seen[key.pipeline] {
+			seen[key.pipeline] = true
+			pipelines = append(pipelines, atc.Pipeline{Name: key.pipeline, TeamName: team})
+		}
+	}
+
+	// The ATC only knows teams that have been given pipelines here.
+	if len(pipelines) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	sort.Slice(pipelines, func(i, j int) bool { return pipelines[i].Name < pipelines[j].Name })
+	respond(w, pipelines)
+}
+
+func (fake *ATC) getPipeline(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	team, pipeline := rata.Param(r, "team_name"), rata.Param(r, "pipeline_name")
+	for key := range fake.jobs {
+		if key.team == team && key.pipeline == pipeline {
+			respond(w, atc.Pipeline{Name: pipeline, TeamName: team})
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (fake *ATC) getJob(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	key := jobKeyFrom(r)
+	if !fake.jobs[key] {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	respond(w, atc.Job{Name: key.job, PipelineName: key.pipeline, TeamName: key.team})
+}
+
+func (fake *ATC) getJobBuild(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	key := jobKeyFrom(r)
+	for _, build := range fake.builds {
+		if key == (jobKey{build.TeamName, build.PipelineName, build.JobName}) && build.Name == rata.Param(r, "build_name") {
+			respond(w, build)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// listJobBuilds returns the job's builds newest first, paginating with the
+// same Link headers and to/limit parameters as the real ATC.
+func (fake *ATC) listJobBuilds(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	key := jobKeyFrom(r)
+	if !fake.jobs[key] {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+	to, _ := strconv.Atoi(r.URL.Query().Get("to"))
+
+	builds := []atc.Build{}
+	for i := len(fake.builds) - 1; i >= 0; i-- {
+		build := fake.builds[i]
+		if key != (jobKey{build.TeamName, build.PipelineName, build.JobName}) || (to > 0 && build.ID > to) {
+			continue
+		}
+
+		if len(builds) == limit {
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s?to=%d&limit=%d>; rel="next"`, fake.server.URL, r.URL.Path, build.ID, limit))
+			break
+		}
+
+		builds = append(builds, build)
+	}
+
+	respond(w, builds)
+}
+
+func (fake *ATC) getBuild(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	id, _ := strconv.Atoi(rata.Param(r, "build_id"))
+	for _, build := range fake.builds {
+		if build.ID == id {
+			respond(w, build)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (fake *ATC) buildResources(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	id, _ := strconv.Atoi(rata.Param(r, "build_id"))
+	resources, found := fake.resources[id]
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	respond(w, resources)
+}
+
+// listResourceVersions returns every version of a resource that contains the
+// filter's fields, newest first, in a single page.
+func (fake *ATC) listResourceVersions(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	team, pipeline, resource := rata.Param(r, "team_name"), rata.Param(r, "pipeline_name"), rata.Param(r, "resource_name")
+	found := false
+	versions := []atc.ResourceVersion{}
+	for i := len(fake.versions) - 1; i >= 0; i-- {
+		v := fake.versions[i]
+		if v.team != team || v.pipeline != pipeline || v.resource != resource {
+			continue
+		}
+
+		found = true
+		if containsFilter(v.Version, r.URL.Query()["filter"]) {
+			versions = append(versions, v.ResourceVersion)
+		}
+	}
+
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	respond(w, versions)
+}
+
+// listBuildsWithVersionAsInput returns the builds of a pipeline whose inputs
+// included a version, newest first.
+func (fake *ATC) listBuildsWithVersionAsInput(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	team, pipeline, resource := rata.Param(r, "team_name"), rata.Param(r, "pipeline_name"), rata.Param(r, "resource_name")
+	id, _ := strconv.Atoi(rata.Param(r, "resource_config_version_id"))
+
+	var version *resourceVersion
+	for i, v := range fake.versions {
+		if v.team == team && v.pipeline == pipeline && v.resource == resource && v.ID == id {
+			version = &fake.versions[i]
+		}
+	}
+
+	if version == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	builds := []atc.Build{}
+	for i := len(fake.builds) - 1; i >= 0; i-- {
+		build := fake.builds[i]
+		if build.TeamName != team || build.PipelineName != pipeline {
+			continue
+		}
+
+		for _, input := range fake.resources[build.ID].Inputs {
+			if input.Name == resource && reflect.DeepEqual(input.Version, version.Version) {
+				builds = append(builds, build)
+				break
+			}
+		}
+	}
+
+	respond(w, builds)
+}
+
+func (fake *ATC) getConfig(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	config, found := fake.configs[pipelineKey{rata.Param(r, "team_name"), rata.Param(r, "pipeline_name")}]
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	respond(w, atc.ConfigResponse{Config: config})
+}
+
+func containsFilter(version atc.Version, filter []string) bool {
+	for _, field := range filter {
+		parts := strings.SplitN(field, ":", 2)
+		if len(parts) != 2 || version[parts[0]] != parts[1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (fake *ATC) getBuildPlan(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	id, _ := strconv.Atoi(rata.Param(r, "build_id"))
+	plan, found := fake.plans[id]
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	respond(w, plan)
+}
+
+func jobKeyFrom(r *http.Request) jobKey {
+	return jobKey{rata.Param(r, "team_name"), rata.Param(r, "pipeline_name"), rata.Param(r, "job_name")}
+}
+
+func respond(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
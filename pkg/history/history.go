@@ -0,0 +1,212 @@
+// Package history records snapshots in a local BoltDB file so that past
+// snapshots can be queried by job, time or resource version.
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/boltdb/bolt"
+	"github.com/concourse/concourse/atc"
+)
+
+var snapshotsBucket = []byte("snapshots")
+
+// Record is a snapshot stored in the history, identified by ID.
+type Record struct {
+	ID       uint64             `json:"id"`
+	Snapshot *stopover.Snapshot `json:"snapshot"`
+}
+
+// Store is a history of snapshots backed by a BoltDB file.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens, creating if necessary, the history store at path.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(snapshotsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Add records a snapshot and returns its ID.
+func (s *Store) Add(snapshot *stopover.Snapshot) (uint64, error) {
+	var id uint64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(snapshotsBucket)
+
+		var err error
+		id, err = bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+
+		return bucket.Put(itob(id), value)
+	})
+
+	return id, err
+}
+
+// Get returns the record with the given ID.
+func (s *Store) Get(id uint64) (Record, bool, error) {
+	var record Record
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(snapshotsBucket).Get(itob(id))
+		if value == nil {
+			return nil
+		}
+
+		found = true
+		record.ID = id
+		return json.Unmarshal(value, &record.Snapshot)
+	})
+
+	return record, found, err
+}
+
+// Query selects records. Zero-valued fields match everything.
+type Query struct {
+	Team     string
+	Pipeline string
+	Job      string
+	Since    time.Time
+	Until    time.Time
+	// Resource and Version select snapshots containing an entry for the
+	// named resource whose version includes every field in Version. Fields
+	// holding hashes, such as commit SHAs and digests, may be abbreviated to
+	// 7 or more hex digits.
+	Resource string
+	Version  atc.Version
+}
+
+// Find returns the records matching q, oldest first.
+func (s *Store) Find(q Query) ([]Record, error) {
+	var records []Record
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(snapshotsBucket).ForEach(func(key, value []byte) error {
+			var snapshot stopover.Snapshot
+			if err := json.Unmarshal(value, &snapshot); err != nil {
+				return err
+			}
+
+			if q.matches(&snapshot) {
+				records = append(records, Record{ID: binary.BigEndian.Uint64(key), Snapshot: &snapshot})
+			}
+
+			return nil
+		})
+	})
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Snapshot.GeneratedAt.Before(records[j].Snapshot.GeneratedAt)
+	})
+
+	return records, err
+}
+
+// Latest returns the most recent record matching q.
+func (s *Store) Latest(q Query) (Record, bool, error) {
+	records, err := s.Find(q)
+	if err != nil || len(records) == 0 {
+		return Record{}, false, err
+	}
+
+	return records[len(records)-1], true, nil
+}
+
+func (q Query) matches(snapshot *stopover.Snapshot) bool {
+	source := snapshot.Source
+
+	switch {
+	case q.Team != "" && q.Team != source.Team:
+		return false
+	case q.Pipeline != "" && q.Pipeline != source.Pipeline:
+		return false
+	case q.Job != "" && q.Job != source.Job:
+		return false
+	case !q.Since.IsZero() && snapshot.GeneratedAt.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && snapshot.GeneratedAt.After(q.Until):
+		return false
+	}
+
+	if q.Resource == "" && len(q.Version) == 0 {
+		return true
+	}
+
+	for _, entry := range snapshot.Entries {
+		if (q.Resource == "" || q.Resource == entry.Name) && containsVersion(entry.Version, q.Version) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsVersion(version, fields atc.Version) bool {
+	for k, v := range fields {
+		if version[k] != v && !abbreviates(v, version[k]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// minAbbreviation is the fewest hex digits accepted as an abbreviated hash,
+// matching git's default short SHA length.
+const minAbbreviation = 7
+
+// abbreviates reports whether short is an abbreviation of the hash full, such
+// as a short commit SHA, or a truncated digest like sha256:8a4f9f1.
+func abbreviates(short, full string) bool {
+	if !strings.HasPrefix(full, short) {
+		return false
+	}
+
+	digits := short[strings.LastIndex(short, ":")+1:]
+	return len(digits) >= minAbbreviation && isHex(digits) && isHex(full[strings.LastIndex(full, ":")+1:])
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+func itob(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b
+}
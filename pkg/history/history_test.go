@@ -0,0 +1,145 @@
+package history_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/history"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+var _ = Describe("Store", func() {
+	var dir string
+	var store *Store
+
+	snapshot := func(job, build string, generatedAt time.Time, ref string) *stopover.Snapshot {
+		return &stopover.Snapshot{
+			Source:      stopover.Source{Team: "main", Pipeline: "promote", Job: job, Build: build},
+			GeneratedAt: generatedAt,
+			Entries: []stopover.Entry{
+				{Key: "resource_version_repo", Kind: stopover.KindInput, Name: "repo", Version: atc.Version{"ref": ref}},
+				{Key: "resource_version_image", Kind: stopover.KindInput, Name: "image", Version: atc.Version{"digest": "sha256:1"}},
+			},
+		}
+	}
+
+	monday := time.Date(2021, 6, 7, 12, 0, 0, 0, time.UTC)
+	tuesday := monday.AddDate(0, 0, 1)
+	wednesday := monday.AddDate(0, 0, 2)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "stopover-history")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		store, err = Open(filepath.Join(dir, "history.db"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		for _, s := range []*stopover.Snapshot{
+			snapshot("prod", "2", wednesday, "ccc"),
+			snapshot("prod", "1", monday, "aaa"),
+			snapshot("staging", "7", tuesday, "aaa"),
+		} {
+			_, err := store.Add(s)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+	})
+
+	AfterEach(func() {
+		store.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("gets snapshots back by ID", func() {
+		record, found, err := store.Get(1)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(found).Should(BeTrue())
+		Ω(record.Snapshot.Source.Build).Should(Equal("2"))
+		Ω(record.Snapshot.GeneratedAt.Equal(wednesday)).Should(BeTrue())
+		Ω(record.Snapshot.Entries).Should(HaveLen(2))
+
+		_, found, err = store.Get(99)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(found).Should(BeFalse())
+	})
+
+	It("lists matching snapshots oldest first", func() {
+		records, err := store.Find(Query{Job: "prod"})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(records).Should(HaveLen(2))
+		Ω(records[0].Snapshot.Source.Build).Should(Equal("1"))
+		Ω(records[1].Snapshot.Source.Build).Should(Equal("2"))
+	})
+
+	It("filters by time range", func() {
+		records, err := store.Find(Query{Since: tuesday, Until: wednesday})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(records).Should(HaveLen(2))
+		Ω(records[0].Snapshot.Source.Job).Should(Equal("staging"))
+	})
+
+	It("finds the snapshot in effect at a given time", func() {
+		record, found, err := store.Latest(Query{Job: "prod", Until: tuesday})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(found).Should(BeTrue())
+		Ω(record.Snapshot.Source.Build).Should(Equal("1"))
+	})
+
+	It("finds snapshots containing a version", func() {
+		records, err := store.Find(Query{Resource: "repo", Version: atc.Version{"ref": "aaa"}})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(records).Should(HaveLen(2))
+		Ω(records[0].Snapshot.Source.Job).Should(Equal("prod"))
+
+		records, err = store.Find(Query{Resource: "image", Version: atc.Version{"ref": "aaa"}})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(records).Should(BeEmpty())
+	})
+
+	It("matches abbreviated hashes", func() {
+		s := snapshot("prod", "3", wednesday.AddDate(0, 0, 1), "fce993c58725102a01d9376714e386f7bb011e2f")
+		s.Entries[1].Version = atc.Version{"digest": "sha256:8a4f9f1647080c224f015cc655146fda7329baa8c7b279b597dee114a69ff97a"}
+		_, err := store.Add(s)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		for _, query := range []Query{
+			{Resource: "repo", Version: atc.Version{"ref": "fce993c"}},
+			{Resource: "repo", Version: atc.Version{"ref": "fce993c58725102a01d9376714e386f7bb011e2f"}},
+			{Resource: "image", Version: atc.Version{"digest": "sha256:8a4f9f1"}},
+		} {
+			records, err := store.Find(query)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(records).Should(HaveLen(1), "%v", query.Version)
+			Ω(records[0].Snapshot.Source.Build).Should(Equal("3"))
+		}
+
+		for _, query := range []Query{
+			{Resource: "repo", Version: atc.Version{"ref": "fce99"}},
+			{Resource: "repo", Version: atc.Version{"ref": "fce993d"}},
+			{Resource: "repo", Version: atc.Version{"ref": "a"}},
+		} {
+			records, err := store.Find(query)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(records).Should(BeEmpty(), "%v", query.Version)
+		}
+	})
+
+	It("persists across reopening", func() {
+		path := filepath.Join(dir, "history.db")
+		Ω(store.Close()).Should(Succeed())
+
+		var err error
+		store, err = Open(path)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		records, err := store.Find(Query{})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(records).Should(HaveLen(3))
+	})
+})
@@ -0,0 +1,287 @@
+// Package metrics records what stopover does when running as a service and
+// exposes it in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+// DurationBuckets are the upper bounds, in seconds, of the ATC request
+// latency histogram.
+var DurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	endpoint, status string
+}
+
+type jobKey struct {
+	team, pipeline, job string
+}
+
+type snapshotKey struct {
+	jobKey
+	result string
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Metrics collects counters, gauges and histograms. It is safe for
+// concurrent use and serves them over HTTP.
+type Metrics struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	durations map[string]*histogram
+	snapshots map[snapshotKey]uint64
+	latest    map[jobKey]*stopover.Snapshot
+	succeeded map[jobKey]time.Time
+}
+
+// New returns an empty Metrics.
+func New() *Metrics {
+	return NewWithClock(time.Now)
+}
+
+// NewWithClock returns an empty Metrics reading the time from now.
+func NewWithClock(now func() time.Time) *Metrics {
+	return &Metrics{
+		now:       now,
+		requests:  map[requestKey]uint64{},
+		durations: map[string]*histogram{},
+		snapshots: map[snapshotKey]uint64{},
+		latest:    map[jobKey]*stopover.Snapshot{},
+		succeeded: map[jobKey]time.Time{},
+	}
+}
+
+// ObserveRequest records a request to an ATC endpoint, named after its
+// atc.Routes entry. Status is the HTTP status code, or "error" if no response
+// was received.
+func (m *Metrics) ObserveRequest(endpoint, status string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{endpoint, status}]++
+
+	h, found := m.durations[endpoint]
+	if !found {
+		h = &histogram{counts: make([]uint64, len(DurationBuckets))}
+		m.durations[endpoint] = h
+	}
+
+	seconds := duration.Seconds()
+	for i, bound := range DurationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// SnapshotSucceeded records a snapshot taken of a job's build.
+func (m *Metrics) SnapshotSucceeded(snapshot *stopover.Snapshot) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	source := snapshot.Source
+	key := jobKey{source.Team, source.PipelineRef().String(), source.Job}
+	m.snapshots[snapshotKey{key, "success"}]++
+	m.succeeded[key] = m.now()
+
+	if latest, found := m.latest[key]; !found || latest.Source.BuildID <= source.BuildID {
+		m.latest[key] = snapshot
+	}
+}
+
+// SnapshotFailed records a failure to take a snapshot of a job's build.
+func (m *Metrics) SnapshotFailed(team string, pipeline atc.PipelineRef, job string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.snapshots[snapshotKey{jobKey{team, pipeline.String(), job}, "failure"}]++
+}
+
+// Transport returns a RoundTripper recording every request made through
+// base, including each retry.
+func (m *Metrics) Transport(base http.RoundTripper) http.RoundTripper {
+	return &transport{metrics: m, base: base}
+}
+
+type transport struct {
+	metrics *Metrics
+	base    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := t.metrics.now()
+	resp, err := t.base.RoundTrip(req)
+
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	t.metrics.ObserveRequest(Endpoint(req), status, t.metrics.now().Sub(start))
+
+	return resp, err
+}
+
+// Endpoint names the atc.Routes entry a request is for, or "other".
+func Endpoint(req *http.Request) string {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for _, route := range atc.Routes {
+		if route.Method == req.Method && matchPath(strings.Split(strings.Trim(route.Path, "/"), "/"), segments) {
+			return route.Name
+		}
+	}
+
+	return "other"
+}
+
+func matchPath(pattern, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+
+	for i := range pattern {
+		if !strings.HasPrefix(pattern[i], ":") && pattern[i] != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	now := m.now()
+
+	header(&b, "stopover_atc_requests_total", "counter", "Requests made to the ATC by endpoint and status.")
+	var lines []string
+	for key, count := range m.requests {
+		lines = append(lines, sample("stopover_atc_requests_total", labels("endpoint", key.endpoint, "status", key.status), float64(count)))
+	}
+	write(&b, lines)
+
+	header(&b, "stopover_atc_request_duration_seconds", "histogram", "Latency of requests made to the ATC by endpoint.")
+	endpoints := make([]string, 0, len(m.durations))
+	for endpoint := range m.durations {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	for _, endpoint := range endpoints {
+		h := m.durations[endpoint]
+		for i, bound := range DurationBuckets {
+			b.WriteString(sample("stopover_atc_request_duration_seconds_bucket", labels("endpoint", endpoint, "le", formatFloat(bound)), float64(h.counts[i])))
+		}
+		b.WriteString(sample("stopover_atc_request_duration_seconds_bucket", labels("endpoint", endpoint, "le", "+Inf"), float64(h.count)))
+		b.WriteString(sample("stopover_atc_request_duration_seconds_sum", labels("endpoint", endpoint), h.sum))
+		b.WriteString(sample("stopover_atc_request_duration_seconds_count", labels("endpoint", endpoint), float64(h.count)))
+	}
+
+	header(&b, "stopover_snapshots_total", "counter", "Snapshots taken by job and result.")
+	lines = nil
+	for key, count := range m.snapshots {
+		lines = append(lines, sample("stopover_snapshots_total", key.labels("result", key.result), float64(count)))
+	}
+	write(&b, lines)
+
+	header(&b, "stopover_last_successful_snapshot_timestamp_seconds", "gauge", "When a snapshot of the job was last taken successfully.")
+	lines = nil
+	for key, at := range m.succeeded {
+		lines = append(lines, sample("stopover_last_successful_snapshot_timestamp_seconds", key.labels(), float64(at.UnixNano())/1e9))
+	}
+	write(&b, lines)
+
+	header(&b, "stopover_snapshot_age_seconds", "gauge", "Time since the build in the job's latest snapshot finished.")
+	lines = nil
+	for key, snapshot := range m.latest {
+		lines = append(lines, sample("stopover_snapshot_age_seconds", key.labels(), now.Sub(buildTime(snapshot)).Seconds()))
+	}
+	write(&b, lines)
+
+	header(&b, "stopover_snapshot_build_info", "gauge", "The build in the job's latest snapshot.")
+	lines = nil
+	for key, snapshot := range m.latest {
+		lines = append(lines, sample("stopover_snapshot_build_info", key.labels("build", snapshot.Source.Build), 1))
+	}
+	write(&b, lines)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// buildTime is when the snapshot's build finished, falling back to when it
+// started or when the snapshot was taken for builds still running.
+func buildTime(snapshot *stopover.Snapshot) time.Time {
+	switch {
+	case !snapshot.Source.EndTime.IsZero():
+		return snapshot.Source.EndTime
+	case !snapshot.Source.StartTime.IsZero():
+		return snapshot.Source.StartTime
+	default:
+		return snapshot.GeneratedAt
+	}
+}
+
+func (k jobKey) labels(extra ...string) string {
+	return labels(append([]string{"team", k.team, "pipeline", k.pipeline, "job", k.job}, extra...)...)
+}
+
+func header(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// write writes lines sorted, so that output is stable between scrapes.
+func write(b *strings.Builder, lines []string) {
+	sort.Strings(lines)
+	for _, line := range lines {
+		b.WriteString(line)
+	}
+}
+
+func sample(name, labels string, value float64) string {
+	return name + labels + " " + formatFloat(value) + "\n"
+}
+
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], escape(pairs[i+1])))
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
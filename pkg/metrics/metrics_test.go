@@ -0,0 +1,106 @@
+package metrics_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/metrics"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var _ = Describe("Metrics", func() {
+	var m *Metrics
+	var now time.Time
+
+	scrape := func() string {
+		var b strings.Builder
+		_, err := m.WriteTo(&b)
+		Ω(err).ShouldNot(HaveOccurred())
+		return b.String()
+	}
+
+	BeforeEach(func() {
+		now = time.Date(2021, 6, 7, 12, 0, 0, 0, time.UTC)
+		m = NewWithClock(func() time.Time { return now })
+	})
+
+	It("names requests after their ATC route", func() {
+		req := httptest.NewRequest("GET", "https://ci.example.com/api/v1/teams/main/pipelines/p/jobs/j/builds/42", nil)
+		Ω(Endpoint(req)).Should(Equal(atc.GetJobBuild))
+
+		req = httptest.NewRequest("GET", "https://ci.example.com/api/v1/builds/1234/resources", nil)
+		Ω(Endpoint(req)).Should(Equal(atc.BuildResources))
+
+		req = httptest.NewRequest("GET", "https://ci.example.com/nowhere", nil)
+		Ω(Endpoint(req)).Should(Equal("other"))
+	})
+
+	It("counts and times requests by endpoint and status", func() {
+		status := http.StatusOK
+		transport := m.Transport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			now = now.Add(200 * time.Millisecond)
+			if status == 0 {
+				return nil, errors.New("connection refused")
+			}
+			return &http.Response{StatusCode: status}, nil
+		}))
+
+		req := httptest.NewRequest("GET", "https://ci.example.com/api/v1/builds/1234/resources", nil)
+		transport.RoundTrip(req)
+		status = http.StatusBadGateway
+		transport.RoundTrip(req)
+		status = 0
+		transport.RoundTrip(req)
+
+		output := scrape()
+		Ω(output).Should(ContainSubstring(`stopover_atc_requests_total{endpoint="BuildResources",status="200"} 1` + "\n"))
+		Ω(output).Should(ContainSubstring(`stopover_atc_requests_total{endpoint="BuildResources",status="502"} 1` + "\n"))
+		Ω(output).Should(ContainSubstring(`stopover_atc_requests_total{endpoint="BuildResources",status="error"} 1` + "\n"))
+		Ω(output).Should(ContainSubstring(`stopover_atc_request_duration_seconds_bucket{endpoint="BuildResources",le="0.1"} 0` + "\n"))
+		Ω(output).Should(ContainSubstring(`stopover_atc_request_duration_seconds_bucket{endpoint="BuildResources",le="0.25"} 3` + "\n"))
+		Ω(output).Should(ContainSubstring(`stopover_atc_request_duration_seconds_count{endpoint="BuildResources"} 3` + "\n"))
+		Ω(output).Should(ContainSubstring("# TYPE stopover_atc_request_duration_seconds histogram\n"))
+	})
+
+	It("tracks snapshots and their age by job", func() {
+		snapshot := &stopover.Snapshot{
+			Source: stopover.Source{
+				Team:     "main",
+				Pipeline: "promote",
+				Job:      "deploy",
+				Build:    "42",
+				BuildID:  1234,
+				EndTime:  now.Add(-time.Hour),
+			},
+		}
+
+		m.SnapshotSucceeded(snapshot)
+		m.SnapshotFailed("main", atc.PipelineRef{Name: "promote"}, "deploy")
+		now = now.Add(time.Minute)
+
+		output := scrape()
+		Ω(output).Should(ContainSubstring(`stopover_snapshots_total{team="main",pipeline="promote",job="deploy",result="success"} 1` + "\n"))
+		Ω(output).Should(ContainSubstring(`stopover_snapshots_total{team="main",pipeline="promote",job="deploy",result="failure"} 1` + "\n"))
+		Ω(output).Should(ContainSubstring(`stopover_last_successful_snapshot_timestamp_seconds{team="main",pipeline="promote",job="deploy"} 1623067200` + "\n"))
+		Ω(output).Should(ContainSubstring(`stopover_snapshot_age_seconds{team="main",pipeline="promote",job="deploy"} 3660` + "\n"))
+		Ω(output).Should(ContainSubstring(`stopover_snapshot_build_info{team="main",pipeline="promote",job="deploy",build="42"} 1` + "\n"))
+	})
+
+	It("escapes label values", func() {
+		m.SnapshotFailed("main", atc.PipelineRef{Name: "promote"}, "say \"hi\"\\n")
+		Ω(scrape()).Should(ContainSubstring(`job="say \"hi\"\\n"`))
+	})
+})
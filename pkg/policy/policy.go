@@ -0,0 +1,232 @@
+// Package policy checks snapshots against rules about which resource
+// versions may be promoted, such as that images come from a trusted registry
+// or that git commits have been tagged.
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"text/template"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/templates"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrViolation is matched by the error returned by Error when a rule of
+// error severity has been violated.
+var ErrViolation = errors.New("policy violated")
+
+// Severity is how seriously a rule's violations are taken. Only errors fail a
+// check.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Rule is a requirement made of every resource it applies to.
+type Rule struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description,omitempty"`
+	Severity    Severity `yaml:"severity,omitempty"`
+	// Resources are path.Match patterns for the names of the resources the
+	// rule applies to. Rules without any apply to every resource.
+	Resources []string `yaml:"resources,omitempty"`
+	// When is an expression limiting the resources the rule applies to.
+	When string `yaml:"when,omitempty"`
+	// Require is an expression that must be true of each resource the rule
+	// applies to.
+	Require string `yaml:"require"`
+
+	when    *template.Template
+	require *template.Template
+}
+
+// Policy is a set of rules, as read from a policy file.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+
+	now func() time.Time
+}
+
+// Option configures a Policy.
+type Option func(*Policy)
+
+// WithClock overrides time.Now, which the daysSince function measures from.
+func WithClock(now func() time.Time) Option {
+	return func(p *Policy) {
+		p.now = now
+	}
+}
+
+// Parse reads a policy file, compiling each rule's expressions. Rules are
+// errors unless given another severity.
+func Parse(data []byte, opts ...Option) (*Policy, error) {
+	policy := &Policy{now: time.Now}
+	for _, opt := range opts {
+		opt(policy)
+	}
+
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, fmt.Errorf("error parsing policy [%v]", err)
+	}
+
+	names := map[string]bool{}
+	for i := range policy.Rules {
+		rule := &policy.Rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d has no name", i+1)
+		}
+
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %q is defined more than once", rule.Name)
+		}
+		names[rule.Name] = true
+
+		switch rule.Severity {
+		case "":
+			rule.Severity = SeverityError
+		case SeverityError, SeverityWarning:
+		default:
+			return nil, fmt.Errorf("rule %q has unknown severity %q: expected error or warning", rule.Name, rule.Severity)
+		}
+
+		for _, pattern := range rule.Resources {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("rule %q has invalid resource pattern %q", rule.Name, pattern)
+			}
+		}
+
+		if rule.Require == "" {
+			return nil, fmt.Errorf("rule %q has no require expression", rule.Name)
+		}
+
+		var err error
+		if rule.require, err = policy.compile(rule.Name, "require", rule.Require); err != nil {
+			return nil, err
+		}
+
+		if rule.When != "" {
+			if rule.when, err = policy.compile(rule.Name, "when", rule.When); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return policy, nil
+}
+
+// compile parses an expression as the pipeline of a text/template if action,
+// so that it is true exactly when the action would be.
+func (p *Policy) compile(rule, field, expression string) (*template.Template, error) {
+	tmpl, err := template.New(rule + "." + field).
+		Funcs(templates.Funcs).
+		Funcs(p.funcs()).
+		Option("missingkey=zero").
+		Parse("{{ if " + expression + " }}true{{ end }}")
+	if err != nil {
+		return nil, fmt.Errorf("rule %q has invalid %s expression [%v]", rule, field, err)
+	}
+
+	return tmpl, nil
+}
+
+// Violation is a resource that did not meet a rule's requirement.
+type Violation struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Key      string   `json:"key"`
+	Message  string   `json:"message"`
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s: %s: %s", v.Severity, v.Rule, v.Key, v.Message)
+}
+
+// Check evaluates every rule against each resource it applies to, returning
+// the violations in rule order. Expressions that cannot be evaluated, e.g.
+// because a date cannot be parsed, are an error.
+func (p *Policy) Check(resources []Resource) ([]Violation, error) {
+	var violations []Violation
+	for _, rule := range p.Rules {
+		for _, resource := range resources {
+			if len(rule.Resources) > 0 && !matchesAny(resource.Name, rule.Resources) {
+				continue
+			}
+
+			if rule.when != nil {
+				applies, err := evaluate(rule.when, resource)
+				if err != nil {
+					return nil, fmt.Errorf("error evaluating rule %q for %s [%v]", rule.Name, resource.Key, err)
+				}
+				if !applies {
+					continue
+				}
+			}
+
+			ok, err := evaluate(rule.require, resource)
+			if err != nil {
+				return nil, fmt.Errorf("error evaluating rule %q for %s [%v]", rule.Name, resource.Key, err)
+			}
+			if ok {
+				continue
+			}
+
+			message := rule.Description
+			if message == "" {
+				message = "does not meet requirement: " + rule.Require
+			}
+
+			violations = append(violations, Violation{
+				Rule:     rule.Name,
+				Severity: rule.Severity,
+				Key:      resource.Key,
+				Message:  message,
+			})
+		}
+	}
+
+	return violations, nil
+}
+
+func evaluate(tmpl *template.Template, resource Resource) (bool, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, resource); err != nil {
+		return false, err
+	}
+
+	return buf.String() == "true", nil
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Error returns an error matching ErrViolation that counts the violations of
+// error severity, or nil if there are none. Warnings never fail a check.
+func Error(violations []Violation) error {
+	var errs, warnings int
+	for _, violation := range violations {
+		if violation.Severity == SeverityError {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+
+	if errs == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %d error(s) and %d warning(s)", ErrViolation, errs, warnings)
+}
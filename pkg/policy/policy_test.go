@@ -0,0 +1,177 @@
+package policy_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/policy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/fakeatc"
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+var _ = Describe("Policy", func() {
+	now := time.Date(2021, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	var resources []Resource
+
+	BeforeEach(func() {
+		resources = []Resource{
+			{
+				Key:      "resource_version_app",
+				Kind:     stopover.KindInput,
+				Name:     "app",
+				Type:     "git",
+				Source:   atc.Source{"uri": "https://github.com/EngineerBetter/app.git", "tag_filter": "v*"},
+				Version:  atc.Version{"ref": "abc"},
+				Metadata: map[string]string{"committer_date": "2021-06-28 09:00:00 +0100"},
+			},
+			{
+				Key:      "resource_version_config",
+				Kind:     stopover.KindInput,
+				Name:     "config",
+				Type:     "git",
+				Source:   atc.Source{"uri": "https://github.com/EngineerBetter/config.git"},
+				Version:  atc.Version{"ref": "def"},
+				Metadata: map[string]string{"committer_date": "2021-05-01 09:00:00 +0100"},
+			},
+			{
+				Key:     "resource_version_image",
+				Kind:    stopover.KindInput,
+				Name:    "image",
+				Type:    "registry-image",
+				Source:  atc.Source{"repository": "docker.io/library/ubuntu"},
+				Version: atc.Version{"digest": "sha256:123"},
+			},
+		}
+	})
+
+	check := func(policyYAML string) ([]Violation, error) {
+		policy, err := Parse([]byte(policyYAML), WithClock(func() time.Time { return now }))
+		Ω(err).ShouldNot(HaveOccurred())
+		return policy.Check(resources)
+	}
+
+	It("reports resources that do not meet a rule's requirement", func() {
+		violations, err := check(`
+rules:
+- name: trusted-registry
+  description: images must come from registry.example.com
+  when: eq .Type "registry-image"
+  require: hasPrefix "registry.example.com/" .Source.repository
+- name: tagged-commits
+  severity: warning
+  when: eq .Type "git"
+  require: .Source.tag_filter
+`)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(violations).Should(Equal([]Violation{
+			{Rule: "trusted-registry", Severity: SeverityError, Key: "resource_version_image", Message: "images must come from registry.example.com"},
+			{Rule: "tagged-commits", Severity: SeverityWarning, Key: "resource_version_config", Message: "does not meet requirement: .Source.tag_filter"},
+		}))
+		Ω(violations[0].String()).Should(Equal("error: trusted-registry: resource_version_image: images must come from registry.example.com"))
+	})
+
+	It("limits rules to resources matching their patterns", func() {
+		violations, err := check(`
+rules:
+- name: pinned-refs
+  resources: [con*]
+  require: eq .Version.ref "abc"
+`)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(violations).Should(HaveLen(1))
+		Ω(violations[0].Key).Should(Equal("resource_version_config"))
+	})
+
+	It("measures the age of versions from their metadata", func() {
+		violations, err := check(`
+rules:
+- name: fresh
+  when: .Metadata.committer_date
+  require: le (daysSince .Metadata.committer_date) 30
+`)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(violations).Should(HaveLen(1))
+		Ω(violations[0].Key).Should(Equal("resource_version_config"))
+	})
+
+	It("fails when an expression cannot be evaluated", func() {
+		_, err := check(`
+rules:
+- name: fresh
+  require: le (daysSince .Metadata.committer_date) 30
+`)
+		Ω(err).Should(MatchError(ContainSubstring(`error evaluating rule "fresh" for resource_version_image`)))
+	})
+
+	It("rejects invalid policies", func() {
+		invalid := map[string]string{
+			"rules:\n- name: a\n  require: true\n  colour: blue\n":             "error parsing policy",
+			"rules:\n- require: true\n":                                        "rule 1 has no name",
+			"rules:\n- name: a\n  require: true\n- name: a\n  require: true\n": `rule "a" is defined more than once`,
+			"rules:\n- name: a\n  severity: fatal\n  require: true\n":          `unknown severity "fatal"`,
+			"rules:\n- name: a\n":                                              `rule "a" has no require expression`,
+			"rules:\n- name: a\n  require: eq .Name (\n":                       `rule "a" has invalid require expression`,
+			"rules:\n- name: a\n  when: isTrusted .Name\n  require: true\n":    `rule "a" has invalid when expression`,
+			"rules:\n- name: a\n  resources: ['[']\n  require: true\n":         `invalid resource pattern "["`,
+		}
+
+		for policyYAML, message := range invalid {
+			_, err := Parse([]byte(policyYAML))
+			Ω(err).Should(MatchError(ContainSubstring(message)), policyYAML)
+		}
+	})
+
+	Describe("Error", func() {
+		It("fails only on violations of error severity", func() {
+			Ω(Error(nil)).Should(Succeed())
+			Ω(Error([]Violation{{Severity: SeverityWarning}})).Should(Succeed())
+
+			err := Error([]Violation{{Severity: SeverityError}, {Severity: SeverityWarning}})
+			Ω(err).Should(MatchError(ErrViolation))
+			Ω(err).Should(MatchError(ContainSubstring("1 error(s) and 1 warning(s)")))
+		})
+	})
+})
+
+var _ = Describe("Resources", func() {
+	It("describes entries using the pipeline config and version metadata", func() {
+		fake := fakeatc.New()
+		defer fake.Close()
+		fake.AddBuild(atc.Build{TeamName: "main", PipelineName: "promote", JobName: "snapshot", Name: "1", Status: atc.StatusSucceeded}, atc.BuildInputsOutputs{
+			Inputs: []atc.PublicBuildInput{{Name: "app", Version: atc.Version{"ref": "abc"}}},
+		})
+		fake.SetVersionMetadata("main", "promote", "app", atc.Version{"ref": "abc"}, []atc.MetadataField{{Name: "committer_date", Value: "2021-06-28 09:00:00 +0100"}})
+
+		snapshot := &stopover.Snapshot{
+			Source: stopover.Source{Team: "main", Pipeline: "promote", Job: "snapshot", Build: "1"},
+			Entries: []stopover.Entry{
+				{Key: "resource_version_app", Kind: stopover.KindInput, Name: "app", Version: atc.Version{"ref": "abc"}},
+				{Key: "resource_type_version_slack", Kind: stopover.KindResourceType, Name: "slack", Version: atc.Version{"digest": "sha256:456"}},
+				{Key: "task_image_version_test", Kind: stopover.KindTaskImage, Name: "test", Version: atc.Version{"digest": "sha256:789"}},
+			},
+		}
+		config := atc.Config{
+			Resources:     atc.ResourceConfigs{{Name: "app", Type: "git", Source: atc.Source{"uri": "https://github.com/EngineerBetter/app.git"}}},
+			ResourceTypes: atc.ResourceTypes{{Name: "slack", Type: "registry-image", Source: atc.Source{"repository": "cfcommunity/slack-notification-resource"}}},
+		}
+
+		resources, err := Resources(snapshot, config, stopover.NewTarget(fake.Client(), "main", atc.PipelineRef{Name: "promote"}))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(resources).Should(HaveLen(3))
+
+		Ω(resources[0].Type).Should(Equal("git"))
+		Ω(resources[0].Source).Should(Equal(atc.Source{"uri": "https://github.com/EngineerBetter/app.git"}))
+		Ω(resources[0].Metadata).Should(Equal(map[string]string{"committer_date": "2021-06-28 09:00:00 +0100"}))
+		Ω(resources[0].Build.Pipeline).Should(Equal("promote"))
+
+		Ω(resources[1].Type).Should(Equal("registry-image"))
+		Ω(resources[1].Source).Should(HaveKeyWithValue("repository", "cfcommunity/slack-notification-resource"))
+
+		Ω(resources[2].Type).Should(BeEmpty())
+		Ω(resources[2].Metadata).Should(BeEmpty())
+	})
+})
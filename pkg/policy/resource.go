@@ -0,0 +1,111 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+// Resource is a snapshot entry as seen by a rule's expressions, which refer
+// to its fields, e.g. .Source.repository or .Metadata.committer_date.
+type Resource struct {
+	Key  string
+	Kind stopover.Kind
+	Name string
+	// Type and Source are the resource's, or resource type's, in the
+	// pipeline config.
+	Type    string
+	Source  atc.Source
+	Version atc.Version
+	// Metadata is the metadata the ATC holds for the version.
+	Metadata map[string]string
+	// Build is the build the snapshot was taken from.
+	Build stopover.Source
+}
+
+// Resources describes each entry of snapshot for rules to be checked
+// against, looking up its type and source in config and the metadata of its
+// version with target. target may be nil, e.g. for one-off builds, leaving
+// metadata empty.
+func Resources(snapshot *stopover.Snapshot, config atc.Config, target *stopover.Target) ([]Resource, error) {
+	resources := make([]Resource, 0, len(snapshot.Entries))
+	for _, entry := range snapshot.Entries {
+		resource := Resource{
+			Key:      entry.Key,
+			Kind:     entry.Kind,
+			Name:     entry.Name,
+			Version:  entry.Version,
+			Metadata: map[string]string{},
+			Build:    snapshot.Source,
+		}
+
+		switch entry.Kind {
+		case stopover.KindResourceType:
+			resourceType, _ := config.ResourceTypes.Lookup(entry.Name)
+			resource.Type, resource.Source = resourceType.Type, resourceType.Source
+
+		case stopover.KindInput, stopover.KindOutput:
+			resourceConfig, found := config.Resources.Lookup(entry.Name)
+			resource.Type, resource.Source = resourceConfig.Type, resourceConfig.Source
+			if !found || target == nil {
+				break
+			}
+
+			version, found, err := target.FindVersion(entry.Name, entry.Version)
+			if err != nil {
+				return nil, err
+			}
+
+			if found {
+				for _, field := range version.Metadata {
+					resource.Metadata[field.Name] = field.Value
+				}
+			}
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources, nil
+}
+
+// funcs are the functions available to expressions beyond those of
+// templates, taking their subject last so that it can be piped in.
+func (p *Policy) funcs() template.FuncMap {
+	return template.FuncMap{
+		"hasPrefix": func(prefix string, value interface{}) bool {
+			return strings.HasPrefix(str(value), prefix)
+		},
+		"hasSuffix": func(suffix string, value interface{}) bool {
+			return strings.HasSuffix(str(value), suffix)
+		},
+		"contains": func(substr string, value interface{}) bool {
+			return strings.Contains(str(value), substr)
+		},
+		"matches": func(pattern string, value interface{}) (bool, error) {
+			return regexp.MatchString(pattern, str(value))
+		},
+		"daysSince": func(value interface{}) (int, error) {
+			t, err := stopover.ParseTime(str(value))
+			if err != nil {
+				return 0, err
+			}
+
+			return int(p.now().Sub(t).Hours() / 24), nil
+		},
+	}
+}
+
+// str formats a field for string functions, treating missing fields as
+// empty.
+func str(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,157 @@
+package provenance
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// PayloadType is the DSSE payload type of an in-toto Statement.
+const PayloadType = "application/vnd.in-toto+json"
+
+// Envelope is a DSSE envelope carrying a signed Statement.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS#8, PKCS#1 or SEC 1 Ed25519, ECDSA
+// or RSA private key, as written by openssl genpkey.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found in private key")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unsupported private key in PEM block %q", block.Type)
+}
+
+// Sign wraps a statement in a DSSE envelope signed with key. The key ID is
+// the hex SHA-256 of the DER encoded public key.
+func Sign(statement Statement, key crypto.Signer) (Envelope, error) {
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	keyID, err := KeyID(key.Public())
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	message := pae(PayloadType, payload)
+	var sig []byte
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, message)
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(message)
+		sig, err = ecdsa.SignASN1(rand.Reader, k, digest[:])
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256(message)
+		sig, err = rsa.SignPSS(rand.Reader, k, crypto.SHA256, digest[:], nil)
+	default:
+		err = fmt.Errorf("unsupported private key type %T", key)
+	}
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	return Envelope{
+		PayloadType: PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []Signature{{KeyID: keyID, Sig: base64.StdEncoding.EncodeToString(sig)}},
+	}, nil
+}
+
+// Verify checks that the envelope has a valid signature by publicKey and
+// returns the statement it carries.
+func Verify(envelope Envelope, publicKey crypto.PublicKey) (Statement, error) {
+	var statement Statement
+
+	if envelope.PayloadType != PayloadType {
+		return statement, fmt.Errorf("unexpected payload type %q", envelope.PayloadType)
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return statement, fmt.Errorf("decoding payload: %s", err)
+	}
+
+	message := pae(envelope.PayloadType, payload)
+	digest := sha256.Sum256(message)
+
+	for _, signature := range envelope.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(signature.Sig)
+		if err != nil {
+			continue
+		}
+
+		var valid bool
+		switch k := publicKey.(type) {
+		case ed25519.PublicKey:
+			valid = ed25519.Verify(k, message, sig)
+		case *ecdsa.PublicKey:
+			valid = ecdsa.VerifyASN1(k, digest[:], sig)
+		case *rsa.PublicKey:
+			valid = rsa.VerifyPSS(k, crypto.SHA256, digest[:], sig, nil) == nil
+		default:
+			return statement, fmt.Errorf("unsupported public key type %T", publicKey)
+		}
+
+		if valid {
+			err := json.Unmarshal(payload, &statement)
+			return statement, err
+		}
+	}
+
+	return statement, errors.New("no valid signature found")
+}
+
+// KeyID identifies a public key by the hex SHA-256 of its DER encoding.
+func KeyID(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// pae is the DSSE pre-authentication encoding of a payload.
+func pae(payloadType string, payload []byte) []byte {
+	return append([]byte(fmt.Sprintf("DSSEv1 %d %s %d ", len(payloadType), payloadType, len(payload))), payload...)
+}
@@ -0,0 +1,191 @@
+// Package provenance describes job builds as in-toto Statements carrying a
+// SLSA provenance predicate, optionally signed in a DSSE envelope.
+package provenance
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/sbom"
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+// Identifiers of the statement, predicate and build formats emitted.
+const (
+	StatementType = "https://in-toto.io/Statement/v0.1"
+	PredicateType = "https://slsa.dev/provenance/v0.2"
+	BuildType     = "https://github.com/EngineerBetter/stopover/concourse-job-build@v1"
+)
+
+// DigestSet maps a hash algorithm to a hex digest.
+type DigestSet map[string]string
+
+// Subject is an artifact a build produced.
+type Subject struct {
+	Name   string    `json:"name"`
+	Digest DigestSet `json:"digest"`
+}
+
+// Statement is an in-toto Statement with a SLSA provenance predicate.
+type Statement struct {
+	Type          string    `json:"_type"`
+	PredicateType string    `json:"predicateType"`
+	Subject       []Subject `json:"subject"`
+	Predicate     Predicate `json:"predicate"`
+}
+
+// Predicate is a SLSA v0.2 provenance predicate.
+type Predicate struct {
+	Builder     Builder          `json:"builder"`
+	BuildType   string           `json:"buildType"`
+	Invocation  Invocation       `json:"invocation"`
+	BuildConfig *json.RawMessage `json:"buildConfig,omitempty"`
+	Metadata    Metadata         `json:"metadata"`
+	Materials   []Material       `json:"materials"`
+}
+
+type Builder struct {
+	ID string `json:"id"`
+}
+
+type Invocation struct {
+	ConfigSource ConfigSource     `json:"configSource"`
+	Parameters   atc.InstanceVars `json:"parameters,omitempty"`
+}
+
+type ConfigSource struct {
+	URI        string `json:"uri"`
+	EntryPoint string `json:"entryPoint"`
+}
+
+type Metadata struct {
+	BuildInvocationID string       `json:"buildInvocationId"`
+	BuildStartedOn    *time.Time   `json:"buildStartedOn,omitempty"`
+	BuildFinishedOn   *time.Time   `json:"buildFinishedOn,omitempty"`
+	Completeness      Completeness `json:"completeness"`
+	Reproducible      bool         `json:"reproducible"`
+}
+
+type Completeness struct {
+	Parameters  bool `json:"parameters"`
+	Environment bool `json:"environment"`
+	Materials   bool `json:"materials"`
+}
+
+// Material is an artifact a build consumed.
+type Material struct {
+	URI    string    `json:"uri"`
+	Digest DigestSet `json:"digest"`
+}
+
+// Option configures a Statement made by New.
+type Option func(*Statement)
+
+// WithCompleteMaterials claims that the materials include everything the
+// build fetched, which is only true of snapshots that include resource types
+// and task images and leave nothing out.
+func WithCompleteMaterials() Option {
+	return func(statement *Statement) {
+		statement.Predicate.Metadata.Completeness.Materials = true
+	}
+}
+
+// New describes the build a snapshot was taken from. Materials are its
+// inputs and subjects its outputs, identified using the pipeline config as
+// for a bill of materials. plan is recorded as the build config. The snapshot
+// must include outputs for the statement to have subjects. One-off builds,
+// having no job, are identified by the URL of the build itself.
+func New(snapshot *stopover.Snapshot, config atc.Config, plan atc.PublicBuildPlan, opts ...Option) Statement {
+	source := snapshot.Source
+	url := strings.TrimSuffix(source.URL, "/")
+
+	var builderID, invocationID string
+	var configSource ConfigSource
+	if source.Pipeline != "" && source.Job != "" {
+		pipelineURL := url + "/teams/" + source.Team + "/pipelines/" + source.Pipeline
+		builderID = pipelineURL + "/jobs/" + source.Job
+		invocationID = builderID + "/builds/" + source.Build
+		configSource = ConfigSource{URI: pipelineURL, EntryPoint: source.Job}
+	} else {
+		builderID = url + "/builds/" + strconv.Itoa(source.BuildID)
+		invocationID = builderID
+	}
+
+	statement := Statement{
+		Type:          StatementType,
+		PredicateType: PredicateType,
+		Subject:       []Subject{},
+		Predicate: Predicate{
+			Builder:   Builder{ID: builderID},
+			BuildType: BuildType,
+			Invocation: Invocation{
+				ConfigSource: configSource,
+				Parameters:   source.InstanceVars,
+			},
+			BuildConfig: plan.Plan,
+			Metadata: Metadata{
+				BuildInvocationID: invocationID,
+				Completeness:      Completeness{Parameters: true},
+			},
+			Materials: []Material{},
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&statement)
+	}
+
+	if !source.StartTime.IsZero() {
+		started := source.StartTime.UTC()
+		statement.Predicate.Metadata.BuildStartedOn = &started
+	}
+	if !source.EndTime.IsZero() {
+		finished := source.EndTime.UTC()
+		statement.Predicate.Metadata.BuildFinishedOn = &finished
+	}
+
+	for _, component := range sbom.Components(snapshot, config) {
+		uri := component.PURL
+		if component.VCSURL != "" {
+			uri = "git+" + component.VCSURL
+		}
+
+		if component.Entry.Kind == stopover.KindOutput {
+			statement.Subject = append(statement.Subject, Subject{Name: uri, Digest: digests(component)})
+		} else {
+			statement.Predicate.Materials = append(statement.Predicate.Materials, Material{URI: uri, Digest: digests(component)})
+		}
+	}
+
+	return statement
+}
+
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// digests identifies a resource version by content where its version
+// carries a digest or commit, and otherwise by the SHA-256 of the version
+// itself, since every in-toto artifact must have a digest.
+func digests(component sbom.Component) DigestSet {
+	switch {
+	case component.SHA256 != "":
+		return DigestSet{"sha256": component.SHA256}
+	case commitPattern.MatchString(component.Version):
+		return DigestSet{"sha1": component.Version}
+	}
+
+	// encoding/json sorts map keys, so this is stable.
+	versionJSON, _ := json.Marshal(component.Entry.Version)
+	sum := sha256.Sum256(versionJSON)
+	return DigestSet{"sha256": hex.EncodeToString(sum[:])}
+}
+
+// Marshal renders a statement as JSON.
+func Marshal(statement Statement) ([]byte, error) {
+	return json.MarshalIndent(statement, "", "  ")
+}
@@ -0,0 +1,166 @@
+package provenance_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/provenance"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+var _ = Describe("Provenance", func() {
+	var snapshot *stopover.Snapshot
+	var config atc.Config
+	var plan atc.PublicBuildPlan
+
+	BeforeEach(func() {
+		snapshot = &stopover.Snapshot{
+			Source: stopover.Source{
+				URL:       "https://ci.example.com",
+				Team:      "main",
+				Pipeline:  "promote",
+				Job:       "build",
+				Build:     "42",
+				BuildID:   1234,
+				StartTime: time.Date(2021, 6, 7, 11, 0, 0, 0, time.UTC),
+				EndTime:   time.Date(2021, 6, 7, 11, 5, 0, 0, time.UTC),
+			},
+			Entries: []stopover.Entry{
+				{Key: "resource_version_app", Kind: stopover.KindInput, Name: "app", Version: atc.Version{"ref": "fce993c58725102a01d9376714e386f7bb011e2f"}},
+				{Key: "resource_version_version", Kind: stopover.KindInput, Name: "version", Version: atc.Version{"number": "1.2.3"}},
+				{Key: "output_version_image", Kind: stopover.KindOutput, Name: "image", Version: atc.Version{"digest": "sha256:9f8e"}},
+			},
+		}
+
+		config = atc.Config{Resources: atc.ResourceConfigs{
+			{Name: "app", Type: "git", Source: atc.Source{"uri": "https://github.com/org/app.git"}},
+			{Name: "image", Type: "registry-image", Source: atc.Source{"repository": "ghcr.io/org/app"}},
+		}}
+
+		raw := json.RawMessage(`{"id":"1","do":[]}`)
+		plan = atc.PublicBuildPlan{Schema: "exec.v2", Plan: &raw}
+	})
+
+	It("describes the build with its inputs as materials and outputs as subjects", func() {
+		statement := New(snapshot, config, plan)
+
+		Ω(statement.Type).Should(Equal("https://in-toto.io/Statement/v0.1"))
+		Ω(statement.PredicateType).Should(Equal("https://slsa.dev/provenance/v0.2"))
+		Ω(statement.Subject).Should(ConsistOf(Subject{
+			Name:   "pkg:oci/app@sha256%3A9f8e?repository_url=ghcr.io/org/app",
+			Digest: DigestSet{"sha256": "9f8e"},
+		}))
+
+		predicate := statement.Predicate
+		Ω(predicate.Builder.ID).Should(Equal("https://ci.example.com/teams/main/pipelines/promote/jobs/build"))
+		Ω(predicate.Invocation.ConfigSource.EntryPoint).Should(Equal("build"))
+		Ω(predicate.Metadata.BuildInvocationID).Should(Equal("https://ci.example.com/teams/main/pipelines/promote/jobs/build/builds/42"))
+		Ω(*predicate.Metadata.BuildStartedOn).Should(Equal(snapshot.Source.StartTime))
+		Ω(*predicate.Metadata.BuildFinishedOn).Should(Equal(snapshot.Source.EndTime))
+		Ω(string(*predicate.BuildConfig)).Should(Equal(`{"id":"1","do":[]}`))
+
+		Ω(predicate.Materials).Should(HaveLen(2))
+		Ω(predicate.Materials[0]).Should(Equal(Material{
+			URI:    "git+https://github.com/org/app.git",
+			Digest: DigestSet{"sha1": "fce993c58725102a01d9376714e386f7bb011e2f"},
+		}))
+		Ω(predicate.Materials[1].URI).Should(Equal("pkg:generic/version@1.2.3"))
+		Ω(predicate.Materials[1].Digest).Should(HaveKey("sha256"))
+		Ω(predicate.Metadata.Completeness.Materials).Should(BeFalse())
+	})
+
+	It("claims complete materials only when asked", func() {
+		statement := New(snapshot, config, plan, WithCompleteMaterials())
+		Ω(statement.Predicate.Metadata.Completeness).Should(Equal(Completeness{Parameters: true, Materials: true}))
+	})
+
+	It("identifies one-off builds by their build URL", func() {
+		snapshot.Source = stopover.Source{URL: "https://ci.example.com/", Team: "main", Build: "1234", BuildID: 1234}
+
+		predicate := New(snapshot, config, plan).Predicate
+		Ω(predicate.Builder.ID).Should(Equal("https://ci.example.com/builds/1234"))
+		Ω(predicate.Metadata.BuildInvocationID).Should(Equal("https://ci.example.com/builds/1234"))
+		Ω(predicate.Invocation.ConfigSource).Should(BeZero())
+	})
+
+	Describe("signing", func() {
+		var statement Statement
+
+		BeforeEach(func() {
+			statement = New(snapshot, config, plan)
+		})
+
+		for name, generate := range map[string]func() crypto.Signer{
+			"ed25519": func() crypto.Signer {
+				_, key, err := ed25519.GenerateKey(rand.Reader)
+				Ω(err).ShouldNot(HaveOccurred())
+				return key
+			},
+			"ecdsa": func() crypto.Signer {
+				key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				Ω(err).ShouldNot(HaveOccurred())
+				return key
+			},
+		} {
+			generate := generate
+
+			It("signs and verifies with "+name+" keys", func() {
+				key := generate()
+				envelope, err := Sign(statement, key)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(envelope.PayloadType).Should(Equal("application/vnd.in-toto+json"))
+
+				keyID, err := KeyID(key.Public())
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(envelope.Signatures[0].KeyID).Should(Equal(keyID))
+
+				verified, err := Verify(envelope, key.Public())
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(verified.Predicate.Builder).Should(Equal(statement.Predicate.Builder))
+			})
+		}
+
+		It("rejects tampered payloads", func() {
+			_, key, err := ed25519.GenerateKey(rand.Reader)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			envelope, err := Sign(statement, key)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			statement.Predicate.Builder.ID = "https://evil.example.com"
+			payload, err := json.Marshal(statement)
+			Ω(err).ShouldNot(HaveOccurred())
+			envelope.Payload = base64.StdEncoding.EncodeToString(payload)
+
+			_, err = Verify(envelope, key.Public())
+			Ω(err).Should(MatchError("no valid signature found"))
+		})
+
+		It("parses PEM encoded PKCS#8 keys", func() {
+			_, key, err := ed25519.GenerateKey(rand.Reader)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			parsed, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(parsed).Should(Equal(key))
+
+			_, err = ParsePrivateKey([]byte("not a key"))
+			Ω(err).Should(MatchError("no PEM block found in private key"))
+		})
+	})
+})
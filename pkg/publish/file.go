@@ -0,0 +1,35 @@
+package publish
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+)
+
+type filePublisher struct {
+	path string
+}
+
+// NewFile returns a Publisher writing to a file:<path> target on the local
+// filesystem, creating parent directories as needed. The path may contain the
+// placeholders understood by Expand.
+func NewFile(target string) (Publisher, error) {
+	return &filePublisher{path: strings.TrimPrefix(target, "file:")}, nil
+}
+
+func (p *filePublisher) Publish(ctx context.Context, snapshot *stopover.Snapshot, data []byte) (string, error) {
+	path := Expand(p.path, snapshot)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
@@ -0,0 +1,276 @@
+package publish
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+)
+
+// GitConfig configures commits to a git repository.
+type GitConfig struct {
+	// PushAttempts is how many times the file is pushed before giving up.
+	// A rejected push is not rebased: the private clone is reset to the
+	// branch as it now is on origin, and the file is rewritten and committed
+	// again on top of whatever was pushed first, so that the commit message
+	// describes the changes from the file that was actually replaced.
+	PushAttempts int
+}
+
+type gitPublisher struct {
+	repo   string
+	branch string
+	path   string
+	config GitConfig
+}
+
+// NewGit returns a Publisher committing to a git:<repo>#<branch>:<path>
+// target. The repo may be any URL git can clone, or a local checkout. A local
+// checkout's origin is cloned and pushed to; without an origin, the branch is
+// committed to in a separate worktree, leaving the checkout's working tree
+// and index alone. The path may contain the placeholders understood by
+// Expand.
+func NewGit(target string, config GitConfig) (Publisher, error) {
+	spec := strings.TrimPrefix(target, "git:")
+	hash := strings.LastIndex(spec, "#")
+	if hash <= 0 {
+		return nil, fmt.Errorf("invalid git target %q: expected git:<repo>#<branch>:<path>", target)
+	}
+
+	repo := spec[:hash]
+	parts := strings.SplitN(spec[hash+1:], ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid git target %q: expected git:<repo>#<branch>:<path>", target)
+	}
+
+	if config.PushAttempts <= 0 {
+		config.PushAttempts = 3
+	}
+
+	return &gitPublisher{repo: repo, branch: parts[0], path: parts[1], config: config}, nil
+}
+
+func (p *gitPublisher) Publish(ctx context.Context, snapshot *stopover.Snapshot, data []byte) (string, error) {
+	dir, push, cleanup, err := p.checkout(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	path := Expand(p.path, snapshot)
+	location := fmt.Sprintf("git:%s#%s:%s", p.repo, p.branch, path)
+	identity := identityArgs(ctx, dir)
+
+	for attempt := 1; ; attempt++ {
+		changed, err := p.commit(ctx, dir, identity, path, snapshot, data)
+		if err != nil {
+			return "", err
+		}
+
+		if !changed {
+			return location + " (unchanged)", nil
+		}
+
+		if !push {
+			return p.located(ctx, dir, location)
+		}
+
+		_, err = git(ctx, dir, "push", "--quiet", "origin", "HEAD:refs/heads/"+p.branch)
+		if err == nil {
+			return p.located(ctx, dir, location)
+		}
+
+		if attempt >= p.config.PushAttempts {
+			return "", fmt.Errorf("pushing after %d attempts: %s", p.config.PushAttempts, err)
+		}
+
+		if err := p.reset(ctx, dir); err != nil {
+			return "", fmt.Errorf("updating after rejected push: %s", err)
+		}
+	}
+}
+
+// commit writes data to path and commits only that file, describing the
+// changes from the version of path already on the branch. It reports whether
+// there was anything to commit.
+func (p *gitPublisher) commit(ctx context.Context, dir string, identity []string, path string, snapshot *stopover.Snapshot, data []byte) (bool, error) {
+	file := filepath.Join(dir, path)
+
+	var previous *stopover.Snapshot
+	if existing, err := ioutil.ReadFile(file); err == nil {
+		previous, err = stopover.Unmarshal(existing)
+		if err != nil {
+			return false, fmt.Errorf("parsing previous %s: %s", path, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return false, err
+	}
+
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		return false, err
+	}
+
+	if _, err := git(ctx, dir, "add", "--", path); err != nil {
+		return false, err
+	}
+
+	if _, err := git(ctx, dir, "diff", "--cached", "--quiet", "--", path); err == nil {
+		return false, nil
+	}
+
+	if _, err := git(ctx, dir, append(identity, "commit", "--quiet", "--message", commitMessage(path, previous, snapshot), "--only", "--", path)...); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// reset discards the commit in the private clone after someone else pushed
+// first, moving it to the branch as it now is on origin so that the file can
+// be rewritten and committed again. Rebasing instead would keep a commit
+// message diffed against a file that has since been replaced.
+func (p *gitPublisher) reset(ctx context.Context, dir string) error {
+	if _, err := git(ctx, dir, "fetch", "--quiet", "origin", p.branch); err != nil {
+		return err
+	}
+
+	_, err := git(ctx, dir, "reset", "--quiet", "--hard", "origin/"+p.branch)
+	return err
+}
+
+func (p *gitPublisher) located(ctx context.Context, dir, location string) (string, error) {
+	sha, err := git(ctx, dir, "rev-parse", "--short", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s (%s)", location, sha), nil
+}
+
+// checkout returns a private working tree on the target branch that cleanup
+// removes, and whether commits made there should be pushed to its origin.
+// The caller's own working tree is never touched: a local checkout with an
+// origin is published to by cloning that origin, and one without is
+// committed to through a separate worktree.
+func (p *gitPublisher) checkout(ctx context.Context) (string, bool, func(), error) {
+	tmp, err := ioutil.TempDir("", "stopover-git")
+	if err != nil {
+		return "", false, nil, err
+	}
+	dir := filepath.Join(tmp, "repo")
+	cleanup := func() { os.RemoveAll(tmp) }
+
+	repo := p.repo
+	if _, err := os.Stat(filepath.Join(p.repo, ".git")); err == nil {
+		origin, err := git(ctx, p.repo, "remote", "get-url", "origin")
+		if err != nil {
+			return p.worktree(ctx, tmp, dir)
+		}
+
+		repo = origin
+		if isLocalPath(origin) && !filepath.IsAbs(origin) {
+			repo = filepath.Join(p.repo, origin)
+		}
+	}
+
+	if _, err := git(ctx, "", "clone", "--quiet", repo, dir); err != nil {
+		cleanup()
+		return "", false, nil, err
+	}
+
+	if _, err := git(ctx, dir, "checkout", "--quiet", p.branch); err != nil {
+		if _, err := git(ctx, dir, "checkout", "--quiet", "-b", p.branch); err != nil {
+			cleanup()
+			return "", false, nil, err
+		}
+	}
+
+	return dir, true, cleanup, nil
+}
+
+// worktree adds a worktree of the local checkout on the target branch, so
+// that the branch can be committed to without disturbing whatever the caller
+// has checked out. git refuses if the branch is checked out already.
+func (p *gitPublisher) worktree(ctx context.Context, tmp, dir string) (string, bool, func(), error) {
+	cleanup := func() {
+		git(context.Background(), p.repo, "worktree", "remove", "--force", dir)
+		os.RemoveAll(tmp)
+	}
+
+	args := []string{"worktree", "add", "--quiet", dir, p.branch}
+	if _, err := git(ctx, p.repo, "rev-parse", "--verify", "--quiet", "refs/heads/"+p.branch); err != nil {
+		args = []string{"worktree", "add", "--quiet", "-b", p.branch, dir}
+	}
+
+	if _, err := git(ctx, p.repo, args...); err != nil {
+		cleanup()
+		return "", false, nil, err
+	}
+
+	return dir, false, cleanup, nil
+}
+
+// isLocalPath reports whether a remote URL is a path on this machine rather
+// than a URL or scp-like address.
+func isLocalPath(url string) bool {
+	if strings.Contains(url, "://") {
+		return false
+	}
+
+	colon := strings.Index(url, ":")
+	slash := strings.Index(url, "/")
+	return colon < 0 || (slash >= 0 && slash < colon)
+}
+
+// identityArgs supplies a committer identity when git has none configured,
+// as is common in CI containers.
+func identityArgs(ctx context.Context, dir string) []string {
+	if name, _ := git(ctx, dir, "config", "user.name"); name != "" {
+		return nil
+	}
+
+	return []string{"-c", "user.name=stopover", "-c", "user.email=stopover@localhost"}
+}
+
+func commitMessage(path string, previous, snapshot *stopover.Snapshot) string {
+	source := snapshot.Source
+	var message strings.Builder
+
+	fmt.Fprintf(&message, "Update %s", path)
+	if source.Job != "" {
+		fmt.Fprintf(&message, " from %s/%s build %s", source.PipelineRef().String(), source.Job, source.Build)
+	}
+	message.WriteString("\n\n")
+
+	changes := stopover.Diff(previous, snapshot)
+	if len(changes) == 0 {
+		message.WriteString("No version changes.\n")
+	}
+	for _, change := range changes {
+		fmt.Fprintf(&message, "* %s\n", change)
+	}
+
+	if source.URL != "" && source.BuildID != 0 {
+		fmt.Fprintf(&message, "\nSource: %s/builds/%d\n", strings.TrimSuffix(source.URL, "/"), source.BuildID)
+	}
+
+	return message.String()
+}
+
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %s\n%s", strings.Join(args, " "), err, output)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
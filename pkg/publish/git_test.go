@@ -0,0 +1,216 @@
+package publish_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/publish"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+var _ = Describe("git publisher", func() {
+	var dir string
+	var bare string
+	var snapshot *stopover.Snapshot
+
+	git := func(dir string, args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		Ω(err).ShouldNot(HaveOccurred(), string(output))
+		return strings.TrimSpace(string(output))
+	}
+
+	publishVersions := func(target string, versions map[string]atc.Version) string {
+		snapshot.Entries = nil
+		for key, version := range versions {
+			kind, name := stopover.ParseKey(key)
+			snapshot.Entries = append(snapshot.Entries, stopover.Entry{Key: key, Kind: kind, Name: name, Version: version})
+		}
+
+		data, err := stopover.Marshal(snapshot)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		publisher, err := New(target, Config{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		location, err := publisher.Publish(context.Background(), snapshot, data)
+		Ω(err).ShouldNot(HaveOccurred())
+		return location
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "stopover-git-test")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		bare = filepath.Join(dir, "envs.git")
+		git(dir, "init", "--quiet", "--bare", "--initial-branch=main", bare)
+
+		snapshot = &stopover.Snapshot{
+			Source: stopover.Source{
+				URL:      "https://ci.example.com",
+				Team:     "main",
+				Pipeline: "promote",
+				Job:      "snapshot",
+				Build:    "42",
+				BuildID:  1234,
+			},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("clones, commits a summary of the changes and pushes", func() {
+		target := "git:" + bare + "#main:envs/{job}/versions.yml"
+
+		location := publishVersions(target, map[string]atc.Version{
+			"resource_version_repo":  {"ref": "aaa"},
+			"resource_version_image": {"digest": "sha256:1"},
+		})
+		Ω(location).Should(HavePrefix("git:" + bare + "#main:envs/snapshot/versions.yml ("))
+
+		snapshot.Source.Build = "43"
+		publishVersions(target, map[string]atc.Version{
+			"resource_version_repo":    {"ref": "bbb"},
+			"resource_version_image":   {"digest": "sha256:1"},
+			"resource_version_version": {"number": "1.0.0"},
+		})
+
+		Ω(git(bare, "show", "main:envs/snapshot/versions.yml")).Should(ContainSubstring("ref: bbb"))
+		Ω(git(bare, "rev-list", "--count", "main")).Should(Equal("2"))
+		Ω(git(bare, "log", "-1", "--format=%B", "main")).Should(Equal(`Update envs/snapshot/versions.yml from promote/snapshot build 43
+
+* resource_version_repo: {ref: aaa} -> {ref: bbb}
+* resource_version_version: added {number: 1.0.0}
+
+Source: https://ci.example.com/builds/1234`))
+	})
+
+	It("does not commit when nothing changed", func() {
+		target := "git:" + bare + "#main:versions.yml"
+		versions := map[string]atc.Version{"resource_version_repo": {"ref": "aaa"}}
+
+		publishVersions(target, versions)
+		location := publishVersions(target, versions)
+
+		Ω(location).Should(HaveSuffix("(unchanged)"))
+		Ω(git(bare, "rev-list", "--count", "main")).Should(Equal("1"))
+	})
+
+	// raceNextPush makes the next push of a versions file lose a race: a
+	// pre-push hook runs commands in a clone of bare, named other, and pushes
+	// them first.
+	raceNextPush := func(commands string) {
+		git(dir, "clone", "--quiet", bare, filepath.Join(dir, "other"))
+
+		hooks := filepath.Join(dir, "hooks")
+		Ω(os.MkdirAll(hooks, 0755)).Should(Succeed())
+		hook := fmt.Sprintf(`#!/bin/sh
+[ -e %[1]s/raced ] && exit 0
+touch %[1]s/raced
+unset GIT_DIR GIT_WORK_TREE GIT_INDEX_FILE
+cd %[1]s/other
+%[2]s
+git add -A
+git -c user.name=other -c user.email=other@example.com commit --quiet -m "Concurrent change"
+git push --quiet origin main
+`, dir, commands)
+		Ω(ioutil.WriteFile(filepath.Join(hooks, "pre-push"), []byte(hook), 0755)).Should(Succeed())
+
+		os.Setenv("GIT_CONFIG_COUNT", "1")
+		os.Setenv("GIT_CONFIG_KEY_0", "core.hooksPath")
+		os.Setenv("GIT_CONFIG_VALUE_0", hooks)
+	}
+
+	AfterEach(func() {
+		os.Unsetenv("GIT_CONFIG_COUNT")
+		os.Unsetenv("GIT_CONFIG_KEY_0")
+		os.Unsetenv("GIT_CONFIG_VALUE_0")
+	})
+
+	It("retries on top of other changes when the push is rejected", func() {
+		target := "git:" + bare + "#main:versions.yml"
+		publishVersions(target, map[string]atc.Version{"resource_version_repo": {"ref": "aaa"}})
+
+		raceNextPush("printf 'someone else' > README")
+		publishVersions(target, map[string]atc.Version{"resource_version_repo": {"ref": "bbb"}})
+
+		Ω(filepath.Join(dir, "raced")).Should(BeAnExistingFile())
+		Ω(git(bare, "rev-list", "--count", "main")).Should(Equal("3"))
+		Ω(git(bare, "show", "main:versions.yml")).Should(ContainSubstring("ref: bbb"))
+		Ω(git(bare, "show", "main:README")).Should(Equal("someone else"))
+	})
+
+	It("rewrites the file against the latest version when another publisher pushed it first", func() {
+		target := "git:" + bare + "#main:versions.yml"
+		publishVersions(target, map[string]atc.Version{"resource_version_repo": {"ref": "aaa"}})
+
+		raceNextPush(`printf 'resource_version_repo:\n  ref: ccc\n' > versions.yml`)
+		snapshot.Source.Build = "44"
+		publishVersions(target, map[string]atc.Version{"resource_version_repo": {"ref": "bbb"}})
+
+		Ω(git(bare, "rev-list", "--count", "main")).Should(Equal("3"))
+		Ω(git(bare, "log", "-1", "--format=%s", "main~1")).Should(Equal("Concurrent change"))
+		Ω(git(bare, "show", "main:versions.yml")).Should(ContainSubstring("ref: bbb"))
+		Ω(git(bare, "log", "-1", "--format=%B", "main")).Should(ContainSubstring("* resource_version_repo: {ref: ccc} -> {ref: bbb}"))
+	})
+
+	It("publishes a local checkout's origin without touching its working tree", func() {
+		publishVersions("git:"+bare+"#main:versions.yml", map[string]atc.Version{"resource_version_repo": {"ref": "aaa"}})
+
+		checkout := filepath.Join(dir, "checkout")
+		git(dir, "clone", "--quiet", bare, checkout)
+		git(checkout, "checkout", "--quiet", "-b", "work")
+		Ω(ioutil.WriteFile(filepath.Join(checkout, "versions.yml"), []byte("uncommitted"), 0644)).Should(Succeed())
+		Ω(ioutil.WriteFile(filepath.Join(checkout, "staged"), []byte("staged"), 0644)).Should(Succeed())
+		git(checkout, "add", "staged")
+
+		publishVersions("git:"+checkout+"#main:versions.yml", map[string]atc.Version{"resource_version_repo": {"ref": "bbb"}})
+
+		Ω(git(bare, "show", "main:versions.yml")).Should(ContainSubstring("ref: bbb"))
+		Ω(git(bare, "ls-tree", "--name-only", "main")).Should(Equal("versions.yml"))
+		Ω(git(checkout, "rev-parse", "--abbrev-ref", "HEAD")).Should(Equal("work"))
+		Ω(git(checkout, "status", "--porcelain")).Should(Equal("A  staged\n M versions.yml"))
+	})
+
+	It("commits to a local checkout without an origin through a separate worktree", func() {
+		checkout := filepath.Join(dir, "local")
+		git(dir, "init", "--quiet", "--initial-branch=work", checkout)
+		git(checkout, "commit", "--quiet", "--allow-empty", "-m", "Initial commit")
+		Ω(ioutil.WriteFile(filepath.Join(checkout, "staged"), []byte("staged"), 0644)).Should(Succeed())
+		git(checkout, "add", "staged")
+
+		publishVersions("git:"+checkout+"#envs:versions.yml", map[string]atc.Version{"resource_version_repo": {"ref": "aaa"}})
+
+		Ω(git(checkout, "show", "envs:versions.yml")).Should(ContainSubstring("ref: aaa"))
+		Ω(git(checkout, "rev-parse", "--abbrev-ref", "HEAD")).Should(Equal("work"))
+		Ω(git(checkout, "status", "--porcelain")).Should(Equal("A  staged"))
+		Ω(strings.Count(git(checkout, "worktree", "list", "--porcelain"), "worktree ")).Should(Equal(1))
+
+		publisher, err := New("git:"+checkout+"#work:versions.yml", Config{})
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = publisher.Publish(context.Background(), snapshot, []byte("resource_version_repo: {ref: bbb}\n"))
+		Ω(err).Should(MatchError(ContainSubstring("already checked out")))
+		Ω(git(checkout, "status", "--porcelain")).Should(Equal("A  staged"))
+	})
+
+	It("rejects invalid targets", func() {
+		_, err := New("git:/some/repo", Config{})
+		Ω(err).Should(MatchError(ContainSubstring("invalid git target")))
+
+		_, err = New("git:/some/repo#main", Config{})
+		Ω(err).Should(MatchError(ContainSubstring("invalid git target")))
+	})
+})
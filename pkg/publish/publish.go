@@ -0,0 +1,60 @@
+// Package publish uploads rendered versions files to where other pipelines
+// can consume them.
+package publish
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+)
+
+// Publisher stores a rendered versions file and returns where it was put.
+type Publisher interface {
+	Publish(ctx context.Context, snapshot *stopover.Snapshot, data []byte) (string, error)
+}
+
+// Config holds the settings for every kind of publisher.
+type Config struct {
+	S3      S3Config
+	Git     GitConfig
+	Webhook WebhookConfig
+}
+
+// New returns the Publisher for target, e.g. s3://bucket/path/versions.yml,
+// git:git@github.com:org/repo.git#main:envs/prod/versions.yml,
+// file:versions/{job}/{build}.yml or https://hooks.example.com/versions.
+func New(target string, config Config) (Publisher, error) {
+	switch {
+	case strings.HasPrefix(target, "s3://"):
+		return NewS3(target, config.S3)
+	case strings.HasPrefix(target, "git:"):
+		return NewGit(target, config.Git)
+	case strings.HasPrefix(target, "file:"):
+		return NewFile(target)
+	case strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "https://"):
+		return NewWebhook(target, config.Webhook)
+	default:
+		return nil, fmt.Errorf("unsupported publish target %q: expected s3://bucket/key, git:<repo>#<branch>:<path>, file:<path> or an http(s) URL", target)
+	}
+}
+
+// Expand replaces placeholders in a publish path with details of the
+// snapshot, so that each snapshot can be stored under its own key:
+//
+//	{team} {pipeline} {job} {build} {build_id} {timestamp}
+//
+// {timestamp} is the snapshot's generation time, e.g. 20210607T120000Z.
+func Expand(path string, snapshot *stopover.Snapshot) string {
+	source := snapshot.Source
+	return strings.NewReplacer(
+		"{team}", source.Team,
+		"{pipeline}", source.Pipeline,
+		"{job}", source.Job,
+		"{build}", source.Build,
+		"{build_id}", strconv.Itoa(source.BuildID),
+		"{timestamp}", snapshot.GeneratedAt.UTC().Format("20060102T150405Z"),
+	).Replace(path)
+}
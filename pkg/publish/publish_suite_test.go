@@ -0,0 +1,13 @@
+package publish_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPublish(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Publish Suite")
+}
@@ -0,0 +1,151 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+)
+
+// S3Config configures uploads to S3 or an S3-compatible store such as MinIO.
+type S3Config struct {
+	// Endpoint overrides the AWS endpoint, e.g. http://localhost:9000.
+	// Requests to a custom endpoint use path-style addressing.
+	Endpoint string
+	Region   string
+	// Credentials default to AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+	// AWS_SESSION_TOKEN.
+	Credentials Credentials
+	// SSE is the server-side encryption algorithm, AES256 or aws:kms.
+	SSE      string
+	KMSKeyID string
+
+	HTTPClient *http.Client
+	Now        func() time.Time
+}
+
+type s3Publisher struct {
+	bucket string
+	key    string
+	config S3Config
+}
+
+// NewS3 returns a Publisher uploading to an s3://bucket/key target. The key
+// may contain the placeholders understood by Expand.
+func NewS3(target string, config S3Config) (Publisher, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Scheme != "s3" || u.Host == "" || key == "" {
+		return nil, fmt.Errorf("invalid S3 target %q: expected s3://bucket/key", target)
+	}
+
+	if config.Region == "" {
+		config.Region = firstNonEmpty(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1")
+	}
+
+	if config.Credentials.AccessKeyID == "" {
+		config.Credentials = Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	switch config.SSE {
+	case "", "AES256", "aws:kms":
+	default:
+		return nil, fmt.Errorf("unsupported server-side encryption %q: expected AES256 or aws:kms", config.SSE)
+	}
+
+	return &s3Publisher{bucket: u.Host, key: key, config: config}, nil
+}
+
+func (p *s3Publisher) Publish(ctx context.Context, snapshot *stopover.Snapshot, data []byte) (string, error) {
+	key := Expand(p.key, snapshot)
+
+	objectURL, err := p.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, objectURL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+
+	md5sum := md5.Sum(data)
+	sha256sum := hexSHA256(data)
+	req.Header.Set("Content-Type", "application/x-yaml")
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5sum[:]))
+	req.Header.Set("X-Amz-Meta-Sha256", sha256sum)
+
+	if p.config.SSE != "" {
+		req.Header.Set("X-Amz-Server-Side-Encryption", p.config.SSE)
+	}
+
+	if p.config.KMSKeyID != "" {
+		req.Header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", p.config.KMSKeyID)
+	}
+
+	signV4(req, p.config.Credentials, p.config.Region, "s3", sha256sum, p.config.Now())
+
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("uploading to s3://%s/%s: %s\n%s", p.bucket, key, resp.Status, body)
+	}
+
+	return fmt.Sprintf("s3://%s/%s (sha256:%s)", p.bucket, key, sha256sum), nil
+}
+
+func (p *s3Publisher) objectURL(key string) (string, error) {
+	escapedKey := (&url.URL{Path: key}).EscapedPath()
+
+	if p.config.Endpoint == "" {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", p.bucket, p.config.Region, escapedKey), nil
+	}
+
+	endpoint, err := url.Parse(p.config.Endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid S3 endpoint %q: %s", p.config.Endpoint, err)
+	}
+
+	return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(endpoint.String(), "/"), p.bucket, escapedKey), nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,132 @@
+package publish_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/publish"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+)
+
+// fakeS3 is a minimal MinIO-style stand-in that stores objects in memory.
+type fakeS3 struct {
+	sync.Mutex
+	objects map[string][]byte
+	headers map[string]http.Header
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	sum := md5.Sum(body)
+	if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("<Error><Code>BadDigest</Code></Error>"))
+		return
+	}
+
+	s.objects[r.URL.Path] = body
+	s.headers[r.URL.Path] = r.Header
+}
+
+var _ = Describe("S3 publisher", func() {
+	var s3 *fakeS3
+	var server *httptest.Server
+	var config S3Config
+	var snapshot *stopover.Snapshot
+
+	BeforeEach(func() {
+		s3 = &fakeS3{objects: map[string][]byte{}, headers: map[string]http.Header{}}
+		server = httptest.NewServer(s3)
+		config = S3Config{
+			Endpoint:    server.URL,
+			Region:      "us-east-1",
+			Credentials: Credentials{AccessKeyID: "minio", SecretAccessKey: "minio123"},
+		}
+		snapshot = &stopover.Snapshot{
+			Source:      stopover.Source{Team: "main", Pipeline: "promote", Job: "snapshot", Build: "42", BuildID: 1234},
+			GeneratedAt: time.Date(2021, 6, 7, 12, 0, 0, 0, time.UTC),
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("uploads the versions file with a content hash", func() {
+		publisher, err := New("s3://versions/prod/versions.yml", Config{S3: config})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		location, err := publisher.Publish(context.Background(), snapshot, []byte("resource_version_a:\n  ref: abc\n"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(location).Should(Equal("s3://versions/prod/versions.yml (sha256:0ae4eeedd783a84eba7bc4ad5c4a114d03a70c15ec97a389c504d6d261d3ec05)"))
+
+		Ω(string(s3.objects["/versions/prod/versions.yml"])).Should(Equal("resource_version_a:\n  ref: abc\n"))
+		Ω(s3.headers["/versions/prod/versions.yml"].Get("X-Amz-Meta-Sha256")).Should(Equal("0ae4eeedd783a84eba7bc4ad5c4a114d03a70c15ec97a389c504d6d261d3ec05"))
+	})
+
+	It("expands placeholders to version the key", func() {
+		publisher, err := NewS3("s3://versions/{pipeline}/{job}/{build}-{timestamp}.yml", config)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = publisher.Publish(context.Background(), snapshot, []byte("{}\n"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(s3.objects).Should(HaveKey("/versions/promote/snapshot/42-20210607T120000Z.yml"))
+	})
+
+	It("sends server-side encryption headers", func() {
+		config.SSE = "aws:kms"
+		config.KMSKeyID = "alias/stopover"
+		publisher, err := NewS3("s3://versions/versions.yml", config)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = publisher.Publish(context.Background(), snapshot, []byte("{}\n"))
+		Ω(err).ShouldNot(HaveOccurred())
+		headers := s3.headers["/versions/versions.yml"]
+		Ω(headers.Get("X-Amz-Server-Side-Encryption")).Should(Equal("aws:kms"))
+		Ω(headers.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id")).Should(Equal("alias/stopover"))
+	})
+
+	It("reports errors from the store", func() {
+		config.Credentials.AccessKeyID = "wrong"
+		publisher, err := NewS3("s3://versions/versions.yml", config)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = publisher.Publish(context.Background(), snapshot, []byte("{}\n"))
+		Ω(err).Should(MatchError(ContainSubstring("403 Forbidden")))
+	})
+
+	It("rejects invalid targets", func() {
+		_, err := NewS3("s3://bucket-only", config)
+		Ω(err).Should(HaveOccurred())
+
+		_, err = New("ftp://somewhere/versions.yml", Config{})
+		Ω(err).Should(MatchError(ContainSubstring("unsupported publish target")))
+
+		config.SSE = "rot13"
+		_, err = NewS3("s3://versions/versions.yml", config)
+		Ω(err).Should(MatchError(ContainSubstring("unsupported server-side encryption")))
+	})
+})
@@ -0,0 +1,63 @@
+package publish
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+)
+
+// WebhookConfig configures POSTs to a webhook.
+type WebhookConfig struct {
+	// HTTPClient defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+type webhookPublisher struct {
+	url    string
+	config WebhookConfig
+}
+
+// NewWebhook returns a Publisher POSTing the versions file to an http:// or
+// https:// URL. Details of the source build are sent as X-Stopover-* headers.
+func NewWebhook(target string, config WebhookConfig) (Publisher, error) {
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+
+	return &webhookPublisher{url: target, config: config}, nil
+}
+
+func (p *webhookPublisher) Publish(ctx context.Context, snapshot *stopover.Snapshot, data []byte) (string, error) {
+	url := Expand(p.url, snapshot)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	source := snapshot.Source
+	req.Header.Set("Content-Type", "application/x-yaml")
+	req.Header.Set("X-Stopover-Team", source.Team)
+	req.Header.Set("X-Stopover-Pipeline", source.PipelineRef().String())
+	req.Header.Set("X-Stopover-Job", source.Job)
+	req.Header.Set("X-Stopover-Build", source.Build)
+	req.Header.Set("X-Stopover-Build-Id", strconv.Itoa(source.BuildID))
+
+	resp, err := p.config.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("POST %s: %s\n%s", url, resp.Status, body)
+	}
+
+	return fmt.Sprintf("%s (%s)", url, resp.Status), nil
+}
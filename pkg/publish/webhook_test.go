@@ -0,0 +1,85 @@
+package publish_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/publish"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+)
+
+var _ = Describe("webhook publisher", func() {
+	var server *httptest.Server
+	var received *http.Request
+	var body []byte
+	var status int
+	var snapshot *stopover.Snapshot
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r
+			body, _ = ioutil.ReadAll(r.Body)
+			w.WriteHeader(status)
+		}))
+		snapshot = &stopover.Snapshot{
+			Source: stopover.Source{Team: "main", Pipeline: "promote", Job: "snapshot", Build: "42", BuildID: 1234},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("POSTs the versions file with details of the build", func() {
+		publisher, err := New(server.URL+"/hooks/{job}", Config{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		location, err := publisher.Publish(context.Background(), snapshot, []byte("resource_version_repo: {ref: abc}\n"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(location).Should(Equal(server.URL + "/hooks/snapshot (200 OK)"))
+
+		Ω(received.Method).Should(Equal("POST"))
+		Ω(received.URL.Path).Should(Equal("/hooks/snapshot"))
+		Ω(received.Header.Get("Content-Type")).Should(Equal("application/x-yaml"))
+		Ω(received.Header.Get("X-Stopover-Pipeline")).Should(Equal("promote"))
+		Ω(received.Header.Get("X-Stopover-Build-Id")).Should(Equal("1234"))
+		Ω(string(body)).Should(Equal("resource_version_repo: {ref: abc}\n"))
+	})
+
+	It("fails on a non-2xx response", func() {
+		status = http.StatusServiceUnavailable
+		publisher, err := New(server.URL, Config{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = publisher.Publish(context.Background(), snapshot, nil)
+		Ω(err).Should(MatchError(ContainSubstring("503 Service Unavailable")))
+	})
+})
+
+var _ = Describe("file publisher", func() {
+	It("writes the versions file, creating directories", func() {
+		dir, err := ioutil.TempDir("", "stopover-file-test")
+		Ω(err).ShouldNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		snapshot := &stopover.Snapshot{Source: stopover.Source{Pipeline: "promote", Job: "snapshot", Build: "42"}}
+		publisher, err := New("file:"+dir+"/{pipeline}/{job}/{build}.yml", Config{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		location, err := publisher.Publish(context.Background(), snapshot, []byte("versions"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(location).Should(Equal(filepath.Join(dir, "promote", "snapshot", "42.yml")))
+
+		contents, err := ioutil.ReadFile(location)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(contents)).Should(Equal("versions"))
+	})
+})
@@ -0,0 +1,206 @@
+// Package sbom renders snapshots as CycloneDX or SPDX bills of materials,
+// identifying each resource version as precisely as its resource type
+// allows.
+package sbom
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+// Component is a resource version in a bill of materials.
+type Component struct {
+	Entry stopover.Entry
+	// ResourceType is the resource's type in the pipeline config, if known.
+	ResourceType string
+	// Version is the most specific single identifier of the resource
+	// version, e.g. a commit SHA, image digest or semver number.
+	Version string
+	// PURL is a package URL identifying the component.
+	PURL string
+	// VCSURL is the repository a git resource was cloned from.
+	VCSURL string
+	// SHA256 is the image digest of an OCI image, without the sha256: prefix.
+	SHA256 string
+	// Container is true for OCI images.
+	Container bool
+}
+
+// Components identifies each entry of snapshot using the type and source of
+// the matching resource, or resource type, in config. Entries for resources
+// missing from config, and task images, which are named after their task
+// rather than a resource, are given generic identifiers.
+func Components(snapshot *stopover.Snapshot, config atc.Config) []Component {
+	components := make([]Component, 0, len(snapshot.Entries))
+	for _, entry := range snapshot.Entries {
+		var resource atc.ResourceConfig
+		switch entry.Kind {
+		case stopover.KindResourceType:
+			resourceType, _ := config.ResourceTypes.Lookup(entry.Name)
+			resource = atc.ResourceConfig{Name: resourceType.Name, Type: resourceType.Type, Source: resourceType.Source}
+		case stopover.KindTaskImage:
+		default:
+			resource, _ = config.Resources.Lookup(entry.Name)
+		}
+
+		components = append(components, identify(entry, resource))
+	}
+
+	return components
+}
+
+func identify(entry stopover.Entry, resource atc.ResourceConfig) Component {
+	component := Component{Entry: entry, ResourceType: resource.Type}
+	version := entry.Version
+
+	switch resource.Type {
+	case "git":
+		uri := sourceString(resource.Source, "uri")
+		component.Version = version["ref"]
+		component.VCSURL = uri
+		if owner, repo, ok := githubRepo(uri); ok {
+			component.PURL = purl("github", owner+"/"+repo, component.Version)
+		} else if uri != "" {
+			component.PURL = genericPURL(entry.Name, component.Version, "vcs_url", "git+"+uri+"@"+component.Version)
+		}
+
+	case "registry-image", "docker-image":
+		repository := sourceString(resource.Source, "repository")
+		component.Container = true
+		component.Version = version["digest"]
+		component.SHA256 = strings.TrimPrefix(component.Version, "sha256:")
+		if repository != "" {
+			component.PURL = ociPURL(repository, component.Version, sourceString(resource.Source, "tag"))
+		}
+
+	case "github-release":
+		owner, repo := sourceString(resource.Source, "owner"), sourceString(resource.Source, "repository")
+		component.Version = version["tag"]
+		if owner != "" && repo != "" {
+			component.PURL = purl("github", strings.ToLower(owner)+"/"+strings.ToLower(repo), component.Version)
+		}
+
+	case "semver":
+		component.Version = version["number"]
+	}
+
+	if component.Version == "" {
+		component.Version = flatten(version)
+	}
+
+	if component.PURL == "" {
+		component.PURL = genericPURL(entry.Name, component.Version)
+	}
+
+	return component
+}
+
+// sourceString returns a string field of a resource's source, ignoring
+// uninterpolated ((vars)) and stripping any credentials embedded in URLs.
+func sourceString(source atc.Source, field string) string {
+	value, _ := source[field].(string)
+	if strings.Contains(value, "((") {
+		return ""
+	}
+
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		u.User = nil
+		return u.String()
+	}
+
+	return value
+}
+
+var githubRepoPattern = regexp.MustCompile(`^(?:https://|git@|ssh://git@)github\.com[:/]([^/]+)/([^/]+?)(?:\.git)?/?$`)
+
+func githubRepo(uri string) (string, string, bool) {
+	match := githubRepoPattern.FindStringSubmatch(uri)
+	if match == nil {
+		return "", "", false
+	}
+
+	return strings.ToLower(match[1]), strings.ToLower(match[2]), true
+}
+
+// ociPURL follows the purl spec for OCI images: the name is the last path
+// segment of the repository, and the fully qualified repository is given as
+// a qualifier.
+func ociPURL(repository, digest, tag string) string {
+	repository = strings.SplitN(repository, "@", 2)[0]
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		if tag == "" {
+			tag = repository[i+1:]
+		}
+		repository = repository[:i]
+	}
+
+	segments := strings.Split(repository, "/")
+	if len(segments) == 1 {
+		segments = []string{"docker.io", "library", segments[0]}
+	} else if !strings.ContainsAny(segments[0], ".:") && segments[0] != "localhost" {
+		segments = append([]string{"docker.io"}, segments...)
+	}
+
+	qualifiers := []string{"repository_url", strings.Join(segments, "/")}
+	if tag != "" {
+		qualifiers = append(qualifiers, "tag", tag)
+	}
+
+	return purl("oci", strings.ToLower(segments[len(segments)-1]), digest, qualifiers...)
+}
+
+func genericPURL(name, version string, qualifiers ...string) string {
+	return purl("generic", name, version, qualifiers...)
+}
+
+// purl builds a package URL, percent-encoding its parts as the purl spec
+// does. The name may include a /-separated namespace. Qualifiers are key,
+// value pairs and must be given sorted by key.
+func purl(kind, name, version string, qualifiers ...string) string {
+	segments := strings.Split(name, "/")
+	for i := range segments {
+		segments[i] = escapePURL(segments[i])
+	}
+
+	result := "pkg:" + kind + "/" + strings.Join(segments, "/")
+	if version != "" {
+		result += "@" + escapePURL(version)
+	}
+
+	for i := 0; i+1 < len(qualifiers); i += 2 {
+		separator := "&"
+		if i == 0 {
+			separator = "?"
+		}
+		result += separator + qualifiers[i] + "=" + strings.ReplaceAll(escapePURL(qualifiers[i+1]), "%2F", "/")
+	}
+
+	return result
+}
+
+func escapePURL(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+// flatten renders a version with several fields as field=value pairs sorted
+// by field, or a single field's value on its own.
+func flatten(version atc.Version) string {
+	if len(version) == 1 {
+		for _, value := range version {
+			return value
+		}
+	}
+
+	fields := make([]string, 0, len(version))
+	for field, value := range version {
+		fields = append(fields, field+"="+value)
+	}
+	sort.Strings(fields)
+
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,205 @@
+package sbom
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/google/uuid"
+)
+
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp  string        `json:"timestamp"`
+	Tools      []cdxTool     `json:"tools"`
+	Component  cdxComponent  `json:"component"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxTool struct {
+	Vendor string `json:"vendor"`
+	Name   string `json:"name"`
+}
+
+type cdxComponent struct {
+	Type               string           `json:"type"`
+	BOMRef             string           `json:"bom-ref"`
+	Name               string           `json:"name"`
+	Version            string           `json:"version,omitempty"`
+	PURL               string           `json:"purl,omitempty"`
+	Hashes             []cdxHash        `json:"hashes,omitempty"`
+	ExternalReferences []cdxExternalRef `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty    `json:"properties,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxExternalRef struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+// CycloneDX renders a CycloneDX 1.4 JSON bill of materials describing the
+// build a snapshot was taken from, which depends on each of its inputs.
+func CycloneDX(snapshot *stopover.Snapshot, components []Component) ([]byte, error) {
+	source := snapshot.Source
+	buildRef := "build"
+
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.4",
+		SerialNumber: "urn:uuid:" + documentID(snapshot).String(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: snapshot.GeneratedAt.UTC().Format(time.RFC3339),
+			Tools:     []cdxTool{{Vendor: "EngineerBetter", Name: "stopover"}},
+			Component: cdxComponent{
+				Type:    "application",
+				BOMRef:  buildRef,
+				Name:    source.PipelineRef().String() + "/" + source.Job,
+				Version: source.Build,
+			},
+			Properties: cdxProperties(buildMetadata(source)),
+		},
+		Components: []cdxComponent{},
+	}
+
+	if url := buildURL(source); url != "" {
+		bom.Metadata.Component.ExternalReferences = []cdxExternalRef{{Type: "build-system", URL: url}}
+	}
+
+	build := cdxDependency{Ref: buildRef}
+	for _, component := range components {
+		ref := component.Entry.Key
+		c := cdxComponent{
+			Type:    "library",
+			BOMRef:  ref,
+			Name:    component.Entry.Name,
+			Version: component.Version,
+			PURL:    component.PURL,
+			Properties: cdxProperties(map[string]string{
+				"concourse:kind":          string(component.Entry.Kind),
+				"concourse:resource_type": component.ResourceType,
+			}),
+		}
+
+		if component.Container {
+			c.Type = "container"
+		}
+
+		if component.SHA256 != "" {
+			c.Hashes = []cdxHash{{Alg: "SHA-256", Content: component.SHA256}}
+		}
+
+		if component.VCSURL != "" {
+			c.Type = "application"
+			c.ExternalReferences = []cdxExternalRef{{Type: "vcs", URL: component.VCSURL}}
+		}
+
+		for field, value := range component.Entry.Version {
+			c.Properties = append(c.Properties, cdxProperty{Name: "concourse:version:" + field, Value: value})
+		}
+		sortProperties(c.Properties)
+
+		bom.Components = append(bom.Components, c)
+		if component.Entry.Kind != stopover.KindOutput {
+			build.DependsOn = append(build.DependsOn, ref)
+		}
+	}
+
+	bom.Dependencies = []cdxDependency{build}
+
+	return json.MarshalIndent(bom, "", "  ")
+}
+
+func cdxProperties(values map[string]string) []cdxProperty {
+	var properties []cdxProperty
+	for name, value := range values {
+		if value != "" {
+			properties = append(properties, cdxProperty{Name: name, Value: value})
+		}
+	}
+	sortProperties(properties)
+
+	return properties
+}
+
+func sortProperties(properties []cdxProperty) {
+	sort.Slice(properties, func(i, j int) bool {
+		return properties[i].Name < properties[j].Name
+	})
+}
+
+// buildMetadata describes the build a snapshot was taken from.
+func buildMetadata(source stopover.Source) map[string]string {
+	metadata := map[string]string{
+		"concourse:url":      source.URL,
+		"concourse:team":     source.Team,
+		"concourse:pipeline": source.PipelineRef().String(),
+		"concourse:job":      source.Job,
+		"concourse:build":    source.Build,
+		"concourse:status":   source.Status,
+	}
+
+	if source.BuildID != 0 {
+		metadata["concourse:build_id"] = strconv.Itoa(source.BuildID)
+	}
+	if !source.StartTime.IsZero() {
+		metadata["concourse:start_time"] = source.StartTime.UTC().Format(time.RFC3339)
+	}
+	if !source.EndTime.IsZero() {
+		metadata["concourse:end_time"] = source.EndTime.UTC().Format(time.RFC3339)
+	}
+
+	return metadata
+}
+
+// buildURL links to the build in the Concourse web UI.
+func buildURL(source stopover.Source) string {
+	if source.URL == "" || source.BuildID == 0 {
+		return ""
+	}
+
+	return strings.TrimSuffix(source.URL, "/") + "/builds/" + strconv.Itoa(source.BuildID)
+}
+
+// documentID is derived from the build and generation time, so that
+// rendering the same snapshot twice gives the same document.
+func documentID(snapshot *stopover.Snapshot) uuid.UUID {
+	source := snapshot.Source
+	name := strings.Join([]string{
+		source.URL,
+		source.Team,
+		source.PipelineRef().String(),
+		source.Job,
+		source.Build,
+		snapshot.GeneratedAt.UTC().Format(time.RFC3339Nano),
+	}, "\n")
+
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte(name))
+}
@@ -0,0 +1,157 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+)
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+	Comment  string   `json:"comment,omitempty"`
+}
+
+type spdxPackage struct {
+	SPDXID                string            `json:"SPDXID"`
+	Name                  string            `json:"name"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+	Checksums             []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs          []spdxExternalRef `json:"externalRefs,omitempty"`
+	Comment               string            `json:"comment,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+const noAssertion = "NOASSERTION"
+
+// SPDX renders an SPDX 2.3 JSON document describing the build a snapshot was
+// taken from as a package that depends on each of its inputs and generates
+// each of its outputs.
+func SPDX(snapshot *stopover.Snapshot, components []Component) ([]byte, error) {
+	source := snapshot.Source
+	name := fmt.Sprintf("%s/%s build %s", source.PipelineRef().String(), source.Job, source.Build)
+
+	namespace := buildURL(source)
+	if namespace == "" {
+		namespace = "https://spdx.org/spdxdocs/stopover"
+	}
+
+	build := spdxPackage{
+		SPDXID:                "SPDXRef-Build",
+		Name:                  source.PipelineRef().String() + "/" + source.Job,
+		VersionInfo:           source.Build,
+		DownloadLocation:      noAssertion,
+		PrimaryPackagePurpose: "APPLICATION",
+		Comment:               formatMetadata(buildMetadata(source)),
+	}
+
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: namespace + "/spdx/" + documentID(snapshot).String(),
+		CreationInfo: spdxCreationInfo{
+			Created:  snapshot.GeneratedAt.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: stopover"},
+			Comment:  "Resource versions used by " + name,
+		},
+		Packages: []spdxPackage{build},
+		Relationships: []spdxRelationship{
+			{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: build.SPDXID},
+		},
+	}
+
+	for _, component := range components {
+		pkg := spdxPackage{
+			SPDXID:           "SPDXRef-" + spdxID(string(component.Entry.Kind)+"-"+component.Entry.Name),
+			Name:             component.Entry.Name,
+			VersionInfo:      component.Version,
+			DownloadLocation: noAssertion,
+			ExternalRefs: []spdxExternalRef{
+				{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: component.PURL},
+			},
+			Comment: formatMetadata(map[string]string{
+				"concourse:resource_type": component.ResourceType,
+				"concourse:version":       flatten(component.Entry.Version),
+			}),
+		}
+
+		switch {
+		case component.Container:
+			pkg.PrimaryPackagePurpose = "CONTAINER"
+		case component.VCSURL != "":
+			pkg.PrimaryPackagePurpose = "SOURCE"
+			pkg.DownloadLocation = "git+" + component.VCSURL + "@" + component.Version
+		}
+
+		if component.SHA256 != "" {
+			pkg.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: component.SHA256}}
+		}
+
+		relationship := spdxRelationship{SPDXElementID: build.SPDXID, RelationshipType: "DEPENDS_ON", RelatedSPDXElement: pkg.SPDXID}
+		if component.Entry.Kind == stopover.KindOutput {
+			relationship.RelationshipType = "GENERATES"
+		}
+
+		doc.Packages = append(doc.Packages, pkg)
+		doc.Relationships = append(doc.Relationships, relationship)
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+var invalidSPDXIDChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+func spdxID(name string) string {
+	return invalidSPDXIDChars.ReplaceAllString(name, "-")
+}
+
+// formatMetadata renders key: value lines sorted by key, omitting empty
+// values.
+func formatMetadata(metadata map[string]string) string {
+	var lines []string
+	for key, value := range metadata {
+		if value != "" {
+			lines = append(lines, key+": "+value)
+		}
+	}
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n")
+}
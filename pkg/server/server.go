@@ -0,0 +1,242 @@
+// Package server serves snapshots over HTTP, so that consumers can look up
+// versions without holding their own ATC credentials.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/EngineerBetter/stopover/pkg/metrics"
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultCacheSize is the number of finished builds' snapshots kept in memory.
+const DefaultCacheSize = 1000
+
+// Server serves
+//
+//	GET /teams/{team}/pipelines/{pipeline}/jobs/{job}/builds/{build}/versions
+//
+// where {build} may be latest-succeeded. Responses are YAML, or JSON when
+// requested with ?format=json or an Accept: application/json header.
+// Pipeline instance vars are given as vars.* query parameters, as in the
+// Concourse web UI. Snapshots containing disabled versions are refused with
+// 409 Conflict unless the Server is created WithAllowDisabled.
+type Server struct {
+	snapshotter   *stopover.Snapshotter
+	allowDisabled bool
+
+	mu        sync.Mutex
+	cache     map[int]*stopover.Snapshot
+	cached    []int
+	cacheSize int
+
+	metrics *metrics.Metrics
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithMetrics records each snapshot taken, and each failure, in m.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(s *Server) {
+		s.metrics = m
+	}
+}
+
+// WithAllowDisabled serves snapshots even if some of their versions have
+// since been disabled, skipping the check.
+func WithAllowDisabled() Option {
+	return func(s *Server) {
+		s.allowDisabled = true
+	}
+}
+
+// New returns a Server taking snapshots with snapshotter, caching up to
+// cacheSize snapshots of finished builds.
+func New(snapshotter *stopover.Snapshotter, cacheSize int, opts ...Option) *Server {
+	s := &Server{
+		snapshotter: snapshotter,
+		cache:       map[int]*stopover.Snapshot{},
+		cacheSize:   cacheSize,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ref, ok := parsePath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	instanceVars, err := atc.InstanceVarsFromQueryParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ref.Pipeline.InstanceVars = instanceVars
+
+	snapshot, err := s.snapshot(ref)
+	if err != nil {
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshot.Versions())
+		return
+	}
+
+	body, err := yaml.Marshal(snapshot.Versions())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-yaml")
+	w.Write(body)
+}
+
+// snapshot resolves the build on every request, since latest-succeeded and
+// running builds change, but reuses snapshots of finished builds. Versions
+// can be disabled at any time, so cached snapshots are checked again.
+func (s *Server) snapshot(ref stopover.BuildRef) (*stopover.Snapshot, error) {
+	build, err := s.snapshotter.ResolveBuild(ref)
+	if err != nil {
+		s.failed(ref)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	snapshot, found := s.cache[build.ID]
+	s.mu.Unlock()
+	if found {
+		if err := s.checkDisabled(ref, snapshot); err != nil {
+			return nil, err
+		}
+		return snapshot, nil
+	}
+
+	snapshot, err = s.snapshotter.SnapshotBuild(build)
+	if err != nil {
+		s.failed(ref)
+		return nil, err
+	}
+
+	if !build.IsRunning() {
+		s.store(build.ID, snapshot)
+	}
+
+	if err := s.checkDisabled(ref, snapshot); err != nil {
+		return nil, err
+	}
+
+	if s.metrics != nil {
+		s.metrics.SnapshotSucceeded(snapshot)
+	}
+
+	return snapshot, nil
+}
+
+func (s *Server) checkDisabled(ref stopover.BuildRef, snapshot *stopover.Snapshot) error {
+	if s.allowDisabled {
+		return nil
+	}
+
+	disabled, _, err := s.snapshotter.DisabledVersions(snapshot)
+	if err == nil {
+		err = stopover.DisabledError(disabled)
+	}
+
+	if err != nil {
+		s.failed(ref)
+	}
+
+	return err
+}
+
+func (s *Server) failed(ref stopover.BuildRef) {
+	if s.metrics != nil {
+		s.metrics.SnapshotFailed(ref.Team, ref.Pipeline, ref.Job)
+	}
+}
+
+func (s *Server) store(id int, snapshot *stopover.Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cacheSize <= 0 {
+		return
+	}
+
+	if _, found := s.cache[id]; !found {
+		s.cached = append(s.cached, id)
+	}
+	s.cache[id] = snapshot
+
+	for len(s.cached) > s.cacheSize {
+		delete(s.cache, s.cached[0])
+		s.cached = s.cached[1:]
+	}
+}
+
+func parsePath(path string) (stopover.BuildRef, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 9 ||
+		parts[0] != "teams" ||
+		parts[2] != "pipelines" ||
+		parts[4] != "jobs" ||
+		parts[6] != "builds" ||
+		parts[8] != "versions" {
+		return stopover.BuildRef{}, false
+	}
+
+	return stopover.BuildRef{
+		Team:     parts[1],
+		Pipeline: atc.PipelineRef{Name: parts[3]},
+		Job:      parts[5],
+		Build:    parts[7],
+	}, true
+}
+
+func wantsJSON(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "json":
+		return true
+	case "yaml":
+		return false
+	}
+
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, stopover.ErrTeamNotFound),
+		errors.Is(err, stopover.ErrPipelineNotFound),
+		errors.Is(err, stopover.ErrJobNotFound),
+		errors.Is(err, stopover.ErrBuildNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, stopover.ErrDisabledVersion):
+		return http.StatusConflict
+	default:
+		return http.StatusBadGateway
+	}
+}
@@ -0,0 +1,151 @@
+package server_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/server"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/EngineerBetter/stopover/pkg/fakeatc"
+	"github.com/EngineerBetter/stopover/pkg/metrics"
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+var _ = Describe("Server", func() {
+	var fake *fakeatc.ATC
+	var server *httptest.Server
+	var running atc.Build
+
+	get := func(path string, headers ...string) (int, string, string) {
+		req, err := http.NewRequest("GET", server.URL+path, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		Ω(err).ShouldNot(HaveOccurred())
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		Ω(err).ShouldNot(HaveOccurred())
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+	}
+
+	BeforeEach(func() {
+		fake = fakeatc.New()
+
+		build := atc.Build{TeamName: "main", PipelineName: "promote", JobName: "test"}
+
+		build.Name, build.Status = "1", atc.StatusSucceeded
+		fake.AddBuild(build, atc.BuildInputsOutputs{Inputs: []atc.PublicBuildInput{
+			{Name: "repo", Version: atc.Version{"ref": "aaa"}},
+		}})
+
+		build.Name, build.Status = "2", atc.StatusFailed
+		fake.AddBuild(build, atc.BuildInputsOutputs{Inputs: []atc.PublicBuildInput{
+			{Name: "repo", Version: atc.Version{"ref": "bbb"}},
+		}})
+
+		build.Name, build.Status = "3", atc.StatusStarted
+		running = fake.AddBuild(build, atc.BuildInputsOutputs{Inputs: []atc.PublicBuildInput{
+			{Name: "repo", Version: atc.Version{"ref": "ccc"}},
+		}})
+
+		snapshotter := stopover.NewSnapshotter(stopover.WithClient(fake.Client()))
+		server = httptest.NewServer(New(snapshotter, DefaultCacheSize))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		fake.Close()
+	})
+
+	It("serves versions as YAML", func() {
+		status, contentType, body := get("/teams/main/pipelines/promote/jobs/test/builds/2/versions")
+		Ω(status).Should(Equal(http.StatusOK))
+		Ω(contentType).Should(Equal("application/x-yaml"))
+		Ω(body).Should(MatchYAML("resource_version_repo: {ref: bbb}"))
+	})
+
+	It("serves versions as JSON when asked", func() {
+		_, contentType, body := get("/teams/main/pipelines/promote/jobs/test/builds/2/versions?format=json")
+		Ω(contentType).Should(Equal("application/json"))
+		Ω(body).Should(MatchJSON(`{"resource_version_repo": {"ref": "bbb"}}`))
+
+		_, _, body = get("/teams/main/pipelines/promote/jobs/test/builds/2/versions", "Accept", "application/json")
+		Ω(body).Should(MatchJSON(`{"resource_version_repo": {"ref": "bbb"}}`))
+	})
+
+	It("resolves latest-succeeded", func() {
+		_, _, body := get("/teams/main/pipelines/promote/jobs/test/builds/latest-succeeded/versions")
+		Ω(body).Should(MatchYAML("resource_version_repo: {ref: aaa}"))
+	})
+
+	It("caches snapshots of finished builds", func() {
+		get("/teams/main/pipelines/promote/jobs/test/builds/1/versions")
+		get("/teams/main/pipelines/promote/jobs/test/builds/1/versions")
+		get("/teams/main/pipelines/promote/jobs/test/builds/latest-succeeded/versions")
+
+		Ω(fake.Requests(atc.BuildResources)).Should(Equal(1))
+	})
+
+	It("does not cache running builds", func() {
+		get("/teams/main/pipelines/promote/jobs/test/builds/3/versions")
+		fake.SetBuildStatus(running.ID, atc.StatusSucceeded)
+		get("/teams/main/pipelines/promote/jobs/test/builds/3/versions")
+		get("/teams/main/pipelines/promote/jobs/test/builds/3/versions")
+
+		Ω(fake.Requests(atc.BuildResources)).Should(Equal(2))
+	})
+
+	It("returns 404 saying what was missing", func() {
+		status, _, body := get("/teams/main/pipelines/promote/jobs/deploy/builds/1/versions")
+		Ω(status).Should(Equal(http.StatusNotFound))
+		Ω(body).Should(ContainSubstring(`job "deploy" not found`))
+
+		status, _, _ = get("/teams/main/pipelines/promote/jobs/test/builds/99/versions")
+		Ω(status).Should(Equal(http.StatusNotFound))
+
+		status, _, _ = get("/not/a/route")
+		Ω(status).Should(Equal(http.StatusNotFound))
+	})
+
+	It("refuses snapshots containing disabled versions unless allowed", func() {
+		get("/teams/main/pipelines/promote/jobs/test/builds/1/versions")
+		fake.DisableVersion("main", "promote", "repo", atc.Version{"ref": "aaa"})
+
+		status, _, body := get("/teams/main/pipelines/promote/jobs/test/builds/1/versions")
+		Ω(status).Should(Equal(http.StatusConflict))
+		Ω(body).Should(ContainSubstring("snapshot contains disabled versions: resource_version_repo {ref: aaa}"))
+
+		status, _, _ = get("/teams/main/pipelines/promote/jobs/test/builds/2/versions")
+		Ω(status).Should(Equal(http.StatusOK))
+
+		server.Close()
+		server = httptest.NewServer(New(stopover.NewSnapshotter(stopover.WithClient(fake.Client())), DefaultCacheSize, WithAllowDisabled()))
+		status, _, body = get("/teams/main/pipelines/promote/jobs/test/builds/1/versions")
+		Ω(status).Should(Equal(http.StatusOK))
+		Ω(body).Should(MatchYAML("resource_version_repo: {ref: aaa}"))
+	})
+
+	It("records snapshots and failures in metrics", func() {
+		m := metrics.New()
+		server.Close()
+		server = httptest.NewServer(New(stopover.NewSnapshotter(stopover.WithClient(fake.Client())), DefaultCacheSize, WithMetrics(m)))
+
+		get("/teams/main/pipelines/promote/jobs/test/builds/1/versions")
+		get("/teams/main/pipelines/promote/jobs/test/builds/1/versions")
+		get("/teams/main/pipelines/promote/jobs/test/builds/99/versions")
+
+		var scraped strings.Builder
+		m.WriteTo(&scraped)
+		Ω(scraped.String()).Should(ContainSubstring(`stopover_snapshots_total{team="main",pipeline="promote",job="test",result="success"} 1`))
+		Ω(scraped.String()).Should(ContainSubstring(`stopover_snapshots_total{team="main",pipeline="promote",job="test",result="failure"} 1`))
+	})
+})
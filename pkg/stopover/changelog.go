@@ -0,0 +1,161 @@
+package stopover
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/concourse/concourse/atc"
+	"github.com/concourse/concourse/go-concourse/concourse"
+)
+
+// ChangelogEntry lists the versions of a resource between two snapshots.
+type ChangelogEntry struct {
+	Change
+	Resource string `json:"resource"`
+	// Versions are the versions after Old up to and including New, newest
+	// first. For a rollback they are the versions after New up to and
+	// including Old, which were rolled back.
+	Versions []atc.ResourceVersion `json:"versions"`
+	Rollback bool                  `json:"rollback,omitempty"`
+	// Note explains why Versions may be incomplete, e.g. because Old is no
+	// longer in the resource's history.
+	Note string `json:"note,omitempty"`
+}
+
+// Changelog is the changes between two snapshots, sorted by key.
+type Changelog []ChangelogEntry
+
+// Changelog pages through the history of each resource whose version
+// differs between old and new, listing the versions in between. Resources
+// added or removed have no versions listed, nor do resource types and task
+// images, whose history the ATC does not expose.
+func (s *Snapshotter) Changelog(team string, pipeline atc.PipelineRef, old, new *Snapshot) (Changelog, error) {
+	changelog := Changelog{}
+	for _, change := range Diff(old, new) {
+		kind, resource := ParseKey(change.Key)
+		entry := ChangelogEntry{Change: change, Resource: resource, Versions: []atc.ResourceVersion{}}
+
+		if change.Old != nil && change.New != nil {
+			if kind == KindResourceType || kind == KindTaskImage {
+				entry.Note = "the ATC does not expose the history of resource types or task images"
+			} else if err := s.fillVersions(team, pipeline, &entry); err != nil {
+				return nil, err
+			}
+		}
+
+		changelog = append(changelog, entry)
+	}
+
+	return changelog, nil
+}
+
+func (s *Snapshotter) fillVersions(team string, pipeline atc.PipelineRef, entry *ChangelogEntry) error {
+	var history []atc.ResourceVersion
+	oldIndex, newIndex := -1, -1
+
+	page := &concourse.Page{Limit: 100}
+	for page != nil && (oldIndex < 0 || newIndex < 0) {
+		versions, pagination, found, err := s.client.Team(team).ResourceVersions(pipeline, entry.Resource, *page, nil)
+		if err != nil {
+			return wrapClientErr("listing versions of resource "+entry.Resource, err)
+		}
+
+		if !found {
+			entry.Note = fmt.Sprintf("resource %q not found in pipeline %q", entry.Resource, pipeline.String())
+			return nil
+		}
+
+		for _, version := range versions {
+			if oldIndex < 0 && equalVersions(version.Version, entry.Old) {
+				oldIndex = len(history)
+			}
+			if newIndex < 0 && equalVersions(version.Version, entry.New) {
+				newIndex = len(history)
+			}
+			history = append(history, version)
+		}
+
+		page = pagination.Next
+	}
+
+	switch {
+	case newIndex < 0 && oldIndex < 0:
+		entry.Note = "neither version found in the resource's history"
+	case newIndex < 0:
+		entry.Note = "new version not found in the resource's history"
+	case oldIndex < 0:
+		entry.Note = "old version not found in the resource's history, listing all older versions"
+		entry.Versions = history[newIndex:]
+	case newIndex < oldIndex:
+		entry.Versions = history[newIndex:oldIndex]
+	default:
+		entry.Rollback = true
+		entry.Versions = history[oldIndex:newIndex]
+	}
+
+	return nil
+}
+
+// Markdown renders the changelog as release notes, with a section per
+// resource listing each version and the first line of its metadata.
+func (c Changelog) Markdown() string {
+	var b strings.Builder
+
+	if len(c) == 0 {
+		b.WriteString("No changes.\n")
+	}
+
+	for i, entry := range c {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+
+		fmt.Fprintf(&b, "## %s\n\n", entry.Resource)
+		switch {
+		case entry.Old == nil:
+			fmt.Fprintf(&b, "Added at `%s`.\n", formatVersion(entry.New))
+			continue
+		case entry.New == nil:
+			fmt.Fprintf(&b, "Removed, was `%s`.\n", formatVersion(entry.Old))
+			continue
+		case entry.Rollback:
+			fmt.Fprintf(&b, "Rolled back from `%s` to `%s`, reverting %s.\n", formatVersion(entry.Old), formatVersion(entry.New), plural(len(entry.Versions), "version"))
+		default:
+			fmt.Fprintf(&b, "`%s` → `%s`, %s.\n", formatVersion(entry.Old), formatVersion(entry.New), plural(len(entry.Versions), "new version"))
+		}
+
+		if entry.Note != "" {
+			fmt.Fprintf(&b, "\n_%s._\n", entry.Note)
+		}
+
+		if len(entry.Versions) > 0 {
+			b.WriteString("\n")
+		}
+		for _, version := range entry.Versions {
+			fmt.Fprintf(&b, "- `%s`", formatVersion(version.Version))
+
+			var fields []string
+			for _, field := range version.Metadata {
+				value := strings.TrimSpace(strings.SplitN(field.Value, "\n", 2)[0])
+				if value != "" {
+					fields = append(fields, field.Name+": "+value)
+				}
+			}
+			if len(fields) > 0 {
+				b.WriteString(" — " + strings.Join(fields, ", "))
+			}
+
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+
+	return fmt.Sprintf("%d %ss", n, noun)
+}
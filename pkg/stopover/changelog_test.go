@@ -0,0 +1,138 @@
+package stopover_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/stopover"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"strconv"
+
+	"github.com/concourse/concourse/atc"
+	"github.com/concourse/concourse/go-concourse/concourse"
+	"github.com/concourse/concourse/go-concourse/concourse/concoursefakes"
+)
+
+var _ = Describe("Changelog", func() {
+	var client *concoursefakes.FakeClient
+	var team *concoursefakes.FakeTeam
+	var snapshotter *Snapshotter
+
+	snapshot := func(versions map[string]atc.Version) *Snapshot {
+		s := &Snapshot{}
+		for key, version := range versions {
+			kind, name := ParseKey(key)
+			s.Entries = append(s.Entries, Entry{Key: key, Kind: kind, Name: name, Version: version})
+		}
+		return s
+	}
+
+	BeforeEach(func() {
+		// app has versions 1 to 250, served newest first two at a time.
+		team = new(concoursefakes.FakeTeam)
+		team.ResourceVersionsStub = func(pipeline atc.PipelineRef, resource string, page concourse.Page, filter atc.Version) ([]atc.ResourceVersion, concourse.Pagination, bool, error) {
+			if resource != "app" {
+				return nil, concourse.Pagination{}, false, nil
+			}
+
+			to := page.To
+			if to == 0 {
+				to = 250
+			}
+
+			var versions []atc.ResourceVersion
+			for id := to; id > to-2 && id > 0; id-- {
+				versions = append(versions, atc.ResourceVersion{
+					ID:       id,
+					Version:  atc.Version{"ref": strconv.Itoa(id)},
+					Metadata: []atc.MetadataField{{Name: "message", Value: "commit " + strconv.Itoa(id) + "\n\nlong description"}},
+				})
+			}
+
+			var pagination concourse.Pagination
+			if to-2 > 0 {
+				pagination.Next = &concourse.Page{To: to - 2, Limit: page.Limit}
+			}
+
+			return versions, pagination, true, nil
+		}
+
+		client = new(concoursefakes.FakeClient)
+		client.TeamReturns(team)
+		snapshotter = NewSnapshotter(WithClient(client))
+	})
+
+	It("lists the versions between the old and new versions, newest first", func() {
+		changelog, err := snapshotter.Changelog("main", atc.PipelineRef{Name: "p"},
+			snapshot(map[string]atc.Version{"resource_version_app": {"ref": "245"}, "resource_version_same": {"ref": "1"}}),
+			snapshot(map[string]atc.Version{"resource_version_app": {"ref": "248"}, "resource_version_same": {"ref": "1"}}),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(changelog).Should(HaveLen(1))
+
+		entry := changelog[0]
+		Ω(entry.Resource).Should(Equal("app"))
+		Ω(entry.Rollback).Should(BeFalse())
+		Ω(entry.Versions).Should(HaveLen(3))
+		Ω(entry.Versions[0].Version).Should(Equal(atc.Version{"ref": "248"}))
+		Ω(entry.Versions[2].Version).Should(Equal(atc.Version{"ref": "246"}))
+
+		Ω(team.ResourceVersionsCallCount()).Should(Equal(3))
+	})
+
+	It("lists the versions reverted by a rollback", func() {
+		changelog, err := snapshotter.Changelog("main", atc.PipelineRef{Name: "p"},
+			snapshot(map[string]atc.Version{"resource_version_app": {"ref": "248"}}),
+			snapshot(map[string]atc.Version{"resource_version_app": {"ref": "246"}}),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(changelog[0].Rollback).Should(BeTrue())
+		Ω(changelog[0].Versions).Should(HaveLen(2))
+		Ω(changelog[0].Versions[0].Version).Should(Equal(atc.Version{"ref": "248"}))
+	})
+
+	It("notes when a version is missing from the history", func() {
+		changelog, err := snapshotter.Changelog("main", atc.PipelineRef{Name: "p"},
+			snapshot(map[string]atc.Version{"resource_version_app": {"ref": "gone"}}),
+			snapshot(map[string]atc.Version{"resource_version_app": {"ref": "3"}}),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(changelog[0].Note).Should(ContainSubstring("old version not found"))
+		Ω(changelog[0].Versions).Should(HaveLen(3))
+	})
+
+	It("notes that resource type history is unavailable", func() {
+		changelog, err := snapshotter.Changelog("main", atc.PipelineRef{Name: "p"},
+			snapshot(map[string]atc.Version{"resource_type_version_app": {"ref": "1"}}),
+			snapshot(map[string]atc.Version{"resource_type_version_app": {"ref": "2"}}),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(changelog[0].Resource).Should(Equal("app"))
+		Ω(changelog[0].Note).Should(ContainSubstring("resource types or task images"))
+		Ω(team.ResourceVersionsCallCount()).Should(Equal(0))
+	})
+
+	It("records added and removed resources without versions", func() {
+		changelog, err := snapshotter.Changelog("main", atc.PipelineRef{Name: "p"},
+			snapshot(map[string]atc.Version{"resource_version_old": {"ref": "1"}}),
+			snapshot(map[string]atc.Version{"resource_version_new": {"ref": "1"}}),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(changelog).Should(HaveLen(2))
+		Ω(team.ResourceVersionsCallCount()).Should(Equal(0))
+	})
+
+	It("renders markdown release notes", func() {
+		changelog, err := snapshotter.Changelog("main", atc.PipelineRef{Name: "p"},
+			snapshot(map[string]atc.Version{"resource_version_app": {"ref": "248"}, "resource_version_old": {"ref": "1"}}),
+			snapshot(map[string]atc.Version{"resource_version_app": {"ref": "250"}}),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(changelog.Markdown()).Should(Equal("## app\n\n" +
+			"`{ref: 248}` → `{ref: 250}`, 2 new versions.\n\n" +
+			"- `{ref: 250}` — message: commit 250\n" +
+			"- `{ref: 249}` — message: commit 249\n" +
+			"\n## old\n\n" +
+			"Removed, was `{ref: 1}`.\n"))
+	})
+})
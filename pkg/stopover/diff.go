@@ -0,0 +1,89 @@
+package stopover
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/concourse/concourse/atc"
+)
+
+// Change is a difference between two snapshots for a single key. Old is nil
+// for added keys and New is nil for removed keys.
+type Change struct {
+	Key string      `json:"key"`
+	Old atc.Version `json:"old,omitempty"`
+	New atc.Version `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Old == nil:
+		return fmt.Sprintf("%s: added %s", c.Key, formatVersion(c.New))
+	case c.New == nil:
+		return fmt.Sprintf("%s: removed %s", c.Key, formatVersion(c.Old))
+	default:
+		return fmt.Sprintf("%s: %s -> %s", c.Key, formatVersion(c.Old), formatVersion(c.New))
+	}
+}
+
+// Diff lists the keys whose versions differ between two snapshots, sorted by
+// key. Either snapshot may be nil.
+func Diff(old, new *Snapshot) []Change {
+	oldVersions := map[string]atc.Version{}
+	if old != nil {
+		oldVersions = old.Versions()
+	}
+
+	newVersions := map[string]atc.Version{}
+	if new != nil {
+		newVersions = new.Versions()
+	}
+
+	var changes []Change
+	for key, oldVersion := range oldVersions {
+		newVersion, found := newVersions[key]
+		if !found {
+			changes = append(changes, Change{Key: key, Old: oldVersion})
+		} else if !equalVersions(oldVersion, newVersion) {
+			changes = append(changes, Change{Key: key, Old: oldVersion, New: newVersion})
+		}
+	}
+
+	for key, newVersion := range newVersions {
+		if _, found := oldVersions[key]; !found {
+			changes = append(changes, Change{Key: key, New: newVersion})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+
+	return changes
+}
+
+func equalVersions(a, b atc.Version) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k, v := range a {
+		if other, found := b[k]; !found || other != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// formatVersion renders a version as {field: value, ...} with sorted fields.
+func formatVersion(version atc.Version) string {
+	fields := make([]string, 0, len(version))
+	for k, v := range version {
+		fields = append(fields, k+": "+v)
+	}
+	sort.Strings(fields)
+
+	return "{" + strings.Join(fields, ", ") + "}"
+}
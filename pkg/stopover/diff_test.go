@@ -0,0 +1,39 @@
+package stopover_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/stopover"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/concourse/atc"
+)
+
+var _ = Describe("Diff", func() {
+	It("lists added, removed and changed keys in order", func() {
+		old := &Snapshot{Entries: []Entry{
+			{Key: "resource_version_a", Version: atc.Version{"ref": "1"}},
+			{Key: "resource_version_b", Version: atc.Version{"ref": "1"}},
+			{Key: "resource_version_c", Version: atc.Version{"ref": "1"}},
+		}}
+		new := &Snapshot{Entries: []Entry{
+			{Key: "resource_version_b", Version: atc.Version{"ref": "2"}},
+			{Key: "resource_version_c", Version: atc.Version{"ref": "1"}},
+			{Key: "resource_version_d", Version: atc.Version{"ref": "1", "tag": "v1"}},
+		}}
+
+		changes := Diff(old, new)
+		Ω(changes).Should(Equal([]Change{
+			{Key: "resource_version_a", Old: atc.Version{"ref": "1"}},
+			{Key: "resource_version_b", Old: atc.Version{"ref": "1"}, New: atc.Version{"ref": "2"}},
+			{Key: "resource_version_d", New: atc.Version{"ref": "1", "tag": "v1"}},
+		}))
+		Ω(changes[0].String()).Should(Equal("resource_version_a: removed {ref: 1}"))
+		Ω(changes[1].String()).Should(Equal("resource_version_b: {ref: 1} -> {ref: 2}"))
+		Ω(changes[2].String()).Should(Equal("resource_version_d: added {ref: 1, tag: v1}"))
+	})
+
+	It("treats a nil snapshot as empty", func() {
+		Ω(Diff(nil, nil)).Should(BeEmpty())
+		Ω(Diff(nil, &Snapshot{Entries: []Entry{{Key: "k", Version: atc.Version{"v": "1"}}}})).Should(HaveLen(1))
+	})
+})
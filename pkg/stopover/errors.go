@@ -0,0 +1,105 @@
+package stopover
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/concourse/concourse/go-concourse/concourse"
+)
+
+// Sentinel errors identifying each way talking to the ATC can fail. Errors
+// returned by a Snapshotter match exactly one of these with errors.Is.
+var (
+	ErrTeamNotFound     = errors.New("team not found")
+	ErrPipelineNotFound = errors.New("pipeline not found")
+	ErrJobNotFound      = errors.New("job not found")
+	ErrBuildNotFound    = errors.New("build not found")
+	ErrResourceNotFound = errors.New("resource not found")
+	ErrUnauthorized     = errors.New("not authorized")
+	ErrForbidden        = errors.New("forbidden")
+	ErrTransport        = errors.New("could not communicate with the ATC")
+)
+
+// Sentinel errors for problems with a snapshot's versions and the outcome of
+// builds triggered by a Target.
+var (
+	ErrDisabledVersion = errors.New("snapshot contains disabled versions")
+	ErrNotPassed       = errors.New("snapshot contains versions that have not passed required jobs")
+	ErrStale           = errors.New("snapshot contains stale versions")
+	ErrInputMismatch   = errors.New("build did not use the snapshot's versions")
+	ErrBuildFailed     = errors.New("build failed")
+	ErrBuildErrored    = errors.New("build errored")
+	ErrBuildAborted    = errors.New("build aborted")
+)
+
+// Error describes a failure talking to the ATC. Kind is one of the Err*
+// sentinels and Cause, when present, is the underlying client error.
+type Error struct {
+	Kind   error
+	Op     string
+	Detail string
+	Cause  error
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return e.Detail
+	}
+
+	return fmt.Sprintf("error %s [%v]", e.Op, e.Cause)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// DisabledError returns an error matching ErrDisabledVersion that names each
+// disabled entry, or nil if there are none.
+func DisabledError(disabled []Entry) error {
+	if len(disabled) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(disabled))
+	for i, entry := range disabled {
+		names[i] = entry.Key + " " + formatVersion(entry.Version)
+	}
+
+	return &Error{
+		Kind:   ErrDisabledVersion,
+		Detail: "snapshot contains disabled versions: " + strings.Join(names, ", "),
+	}
+}
+
+func notFound(kind error, detail string) error {
+	return &Error{Kind: kind, Detail: detail}
+}
+
+// wrapClientErr classifies an error returned by the concourse client.
+func wrapClientErr(op string, err error) error {
+	forbidden := concourse.ErrForbidden
+
+	switch {
+	case errors.Is(err, concourse.ErrUnauthorized):
+		return &Error{
+			Kind:   ErrUnauthorized,
+			Op:     op,
+			Cause:  err,
+			Detail: fmt.Sprintf("error %s [%v]: check that ATC_BEARER_TOKEN is valid and has not expired", op, err),
+		}
+	case errors.As(err, &forbidden):
+		return &Error{
+			Kind:   ErrForbidden,
+			Op:     op,
+			Cause:  err,
+			Detail: fmt.Sprintf("error %s [%v]: the bearer token does not have access to this team", op, err),
+		}
+	default:
+		return &Error{Kind: ErrTransport, Op: op, Cause: err}
+	}
+}
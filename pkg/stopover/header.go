@@ -0,0 +1,80 @@
+package stopover
+
+import (
+	"sort"
+	"time"
+
+	"github.com/concourse/concourse/atc"
+	"gopkg.in/yaml.v2"
+)
+
+// HeaderKey is the key a versions file's header is written under. The header
+// is just another var to `fly set-pipeline --load-vars-from`, so pipelines
+// loading the file are unaffected by it.
+const HeaderKey = "stopover"
+
+// SchemaVersion is the version of the versions file format, incremented
+// whenever a change would break existing consumers.
+const SchemaVersion = 1
+
+// Header records where a versions file came from.
+type Header struct {
+	SchemaVersion   int              `yaml:"schema_version"`
+	ATC             string           `yaml:"atc,omitempty"`
+	Team            string           `yaml:"team,omitempty"`
+	Pipeline        string           `yaml:"pipeline,omitempty"`
+	InstanceVars    atc.InstanceVars `yaml:"instance_vars,omitempty"`
+	Job             string           `yaml:"job,omitempty"`
+	Build           string           `yaml:"build,omitempty"`
+	BuildID         int              `yaml:"build_id,omitempty"`
+	GeneratedAt     time.Time        `yaml:"generated_at,omitempty"`
+	StopoverVersion string           `yaml:"stopover_version,omitempty"`
+}
+
+// NewHeader describes the build a snapshot was taken from, and the version of
+// stopover that took it.
+func NewHeader(snapshot *Snapshot, stopoverVersion string) Header {
+	return Header{
+		SchemaVersion:   SchemaVersion,
+		ATC:             snapshot.Source.URL,
+		Team:            snapshot.Source.Team,
+		Pipeline:        snapshot.Source.Pipeline,
+		InstanceVars:    snapshot.Source.InstanceVars,
+		Job:             snapshot.Source.Job,
+		Build:           snapshot.Source.Build,
+		BuildID:         snapshot.Source.BuildID,
+		GeneratedAt:     snapshot.GeneratedAt.UTC(),
+		StopoverVersion: stopoverVersion,
+	}
+}
+
+// MarshalWithHeader renders a snapshot as a versions file like Marshal, with
+// the header written first.
+func MarshalWithHeader(snapshot *Snapshot, header Header) ([]byte, error) {
+	versions := snapshot.Versions()
+	keys := make([]string, 0, len(versions))
+	for key := range versions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	file := yaml.MapSlice{{Key: HeaderKey, Value: header}}
+	for _, key := range keys {
+		file = append(file, yaml.MapItem{Key: key, Value: versions[key]})
+	}
+
+	return yaml.Marshal(file)
+}
+
+func (h *Header) apply(snapshot *Snapshot) {
+	snapshot.Source = Source{
+		URL:          h.ATC,
+		Team:         h.Team,
+		Pipeline:     h.Pipeline,
+		InstanceVars: h.InstanceVars,
+		Job:          h.Job,
+		Build:        h.Build,
+		BuildID:      h.BuildID,
+	}
+	snapshot.GeneratedAt = h.GeneratedAt
+}
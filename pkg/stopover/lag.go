@@ -0,0 +1,175 @@
+package stopover
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/concourse/concourse/atc"
+	"github.com/concourse/concourse/go-concourse/concourse"
+)
+
+// Lag records how far a snapshot entry's version is behind the newest
+// version of its resource.
+type Lag struct {
+	Entry Entry
+	// Found is false when the pipeline has no record of the version, in
+	// which case Behind is meaningless.
+	Found bool
+	// Behind counts the enabled versions of the resource newer than the
+	// entry's.
+	Behind int
+	// Latest is the newest enabled version of the resource.
+	Latest atc.Version
+	// Created is when the version was made according to its metadata, or
+	// zero if unknown; see VersionTime.
+	Created time.Time
+}
+
+// Age is how old the version is at now, or zero if unknown.
+func (l Lag) Age(now time.Time) time.Duration {
+	if l.Created.IsZero() {
+		return 0
+	}
+
+	return now.Sub(l.Created)
+}
+
+// Stale reports whether the version is more than maxBehind versions behind
+// the latest, or older than maxAge at now. A negative maxBehind or zero
+// maxAge disables that threshold. Versions the pipeline does not know are
+// never stale, as how far behind they are cannot be told.
+func (l Lag) Stale(maxBehind int, maxAge time.Duration, now time.Time) bool {
+	if !l.Found {
+		return false
+	}
+
+	return (maxBehind >= 0 && l.Behind > maxBehind) || (maxAge > 0 && l.Age(now) > maxAge)
+}
+
+// StaleError returns an error matching ErrStale that names each stale entry,
+// or nil if there are none.
+func StaleError(stale []Lag) error {
+	if len(stale) == 0 {
+		return nil
+	}
+
+	var keys []string
+	for _, lag := range stale {
+		keys = append(keys, lag.Entry.Key)
+	}
+
+	return fmt.Errorf("%w: %s", ErrStale, strings.Join(keys, ", "))
+}
+
+// Lag pages through the versions of each input and output in snapshot,
+// newest first, counting the enabled versions newer than the snapshot's.
+// Resource types and task images are skipped, as the ATC does not expose
+// their history.
+func (t *Target) Lag(snapshot *Snapshot) ([]Lag, error) {
+	var lags []Lag
+	for _, entry := range snapshot.Entries {
+		if entry.Kind == KindResourceType || entry.Kind == KindTaskImage {
+			continue
+		}
+
+		lag, err := t.lag(entry)
+		if err != nil {
+			return nil, err
+		}
+
+		lags = append(lags, lag)
+	}
+
+	return lags, nil
+}
+
+func (t *Target) lag(entry Entry) (Lag, error) {
+	team := t.client.Team(t.team)
+	lag := Lag{Entry: entry}
+
+	page := &concourse.Page{Limit: 100}
+	for page != nil {
+		versions, pagination, found, err := team.ResourceVersions(t.pipeline, entry.Name, *page, nil)
+		if err != nil {
+			return Lag{}, wrapClientErr("listing versions of resource "+entry.Name, err)
+		}
+
+		if !found {
+			return Lag{}, notFound(ErrResourceNotFound, fmt.Sprintf("resource %q not found in pipeline %q", entry.Name, t.pipeline.String()))
+		}
+
+		for _, version := range versions {
+			if equalVersions(version.Version, entry.Version) {
+				lag.Found = true
+				lag.Created, _ = VersionTime(version)
+				if lag.Latest == nil {
+					lag.Latest = version.Version
+				}
+				return lag, nil
+			}
+
+			if !version.Enabled {
+				continue
+			}
+
+			if lag.Latest == nil {
+				lag.Latest = version.Version
+			}
+			lag.Behind++
+		}
+
+		page = pagination.Next
+	}
+
+	return lag, nil
+}
+
+// timeFields are the metadata fields resources commonly record when a
+// version was made, most specific first.
+var timeFields = []string{"committer_date", "author_date", "created_at", "created", "published_at", "timestamp", "time"}
+
+// VersionTime returns when a version was made, from the first date found in
+// its metadata fields, e.g. the git resource's committer_date, or in a time
+// field of the version itself, as the time resource records.
+func VersionTime(version atc.ResourceVersion) (time.Time, bool) {
+	metadata := map[string]string{}
+	for _, field := range version.Metadata {
+		metadata[field.Name] = field.Value
+	}
+
+	for _, field := range timeFields {
+		if t, err := ParseTime(metadata[field]); err == nil {
+			return t, true
+		}
+	}
+
+	if t, err := ParseTime(version.Version["time"]); err == nil {
+		return t, true
+	}
+
+	return time.Time{}, false
+}
+
+// timeLayouts are the formats resources commonly write dates in.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05 MST",
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02",
+}
+
+// ParseTime parses a date in any of the formats resources commonly write
+// them in, such as RFC 3339 or git's "2006-01-02 15:04:05 -0700".
+func ParseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("cannot parse %q as a date", value)
+}
@@ -0,0 +1,95 @@
+package stopover_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/stopover"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/fakeatc"
+	"github.com/concourse/concourse/atc"
+)
+
+var _ = Describe("Lag", func() {
+	var fake *fakeatc.ATC
+	var target *Target
+	var snapshot *Snapshot
+
+	BeforeEach(func() {
+		fake = fakeatc.New()
+		for i, ref := range []string{"aaa", "bbb", "ccc", "ddd"} {
+			fake.AddBuild(atc.Build{TeamName: "main", PipelineName: "prod", JobName: "deploy", Name: ref, Status: atc.StatusSucceeded}, atc.BuildInputsOutputs{
+				Inputs: []atc.PublicBuildInput{
+					{Name: "app", Version: atc.Version{"ref": ref}},
+					{Name: "timer", Version: atc.Version{"time": time.Date(2021, 6, 1+i, 0, 0, 0, 0, time.UTC).Format("2006-01-02 15:04:05.999999999 -0700 MST")}},
+				},
+			})
+		}
+		fake.SetVersionMetadata("main", "prod", "app", atc.Version{"ref": "aaa"}, []atc.MetadataField{{Name: "committer_date", Value: "2021-05-01 09:00:00 +0100"}})
+		fake.DisableVersion("main", "prod", "app", atc.Version{"ref": "ccc"})
+
+		target = NewTarget(fake.Client(), "main", atc.PipelineRef{Name: "prod"})
+		snapshot = &Snapshot{Entries: []Entry{
+			{Key: "resource_version_app", Kind: KindInput, Name: "app", Version: atc.Version{"ref": "aaa"}},
+			{Key: "resource_version_timer", Kind: KindInput, Name: "timer", Version: atc.Version{"time": "2021-06-04 00:00:00 +0000 UTC"}},
+			{Key: "resource_type_version_slack", Kind: KindResourceType, Name: "slack", Version: atc.Version{"digest": "sha256:111"}},
+		}}
+	})
+
+	AfterEach(func() {
+		fake.Close()
+	})
+
+	It("counts the enabled versions newer than each entry's", func() {
+		lags, err := target.Lag(snapshot)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(lags).Should(HaveLen(2))
+
+		Ω(lags[0].Entry.Key).Should(Equal("resource_version_app"))
+		Ω(lags[0].Found).Should(BeTrue())
+		Ω(lags[0].Behind).Should(Equal(2))
+		Ω(lags[0].Latest).Should(Equal(atc.Version{"ref": "ddd"}))
+		Ω(lags[0].Created).Should(BeTemporally("==", time.Date(2021, 5, 1, 8, 0, 0, 0, time.UTC)))
+
+		Ω(lags[1].Found).Should(BeTrue())
+		Ω(lags[1].Behind).Should(Equal(0))
+		Ω(lags[1].Latest).Should(Equal(snapshot.Entries[1].Version))
+		Ω(lags[1].Created).Should(BeTemporally("==", time.Date(2021, 6, 4, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("reports versions the pipeline does not know", func() {
+		snapshot.Entries[0].Version = atc.Version{"ref": "zzz"}
+
+		lags, err := target.Lag(snapshot)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(lags[0].Found).Should(BeFalse())
+		Ω(lags[0].Stale(0, 0, time.Now())).Should(BeFalse())
+	})
+
+	It("fails for resources missing from the pipeline", func() {
+		snapshot.Entries[0].Name = "other"
+
+		_, err := target.Lag(snapshot)
+		Ω(err).Should(MatchError(`resource "other" not found in pipeline "prod"`))
+		Ω(err).Should(MatchError(ErrResourceNotFound))
+	})
+
+	It("judges staleness against thresholds", func() {
+		now := time.Date(2021, 6, 10, 0, 0, 0, 0, time.UTC)
+		lag := Lag{Found: true, Behind: 2, Created: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)}
+
+		Ω(lag.Age(now)).Should(Equal(9 * 24 * time.Hour))
+		Ω(lag.Stale(-1, 0, now)).Should(BeFalse())
+		Ω(lag.Stale(2, 0, now)).Should(BeFalse())
+		Ω(lag.Stale(1, 0, now)).Should(BeTrue())
+		Ω(lag.Stale(-1, 10*24*time.Hour, now)).Should(BeFalse())
+		Ω(lag.Stale(-1, 8*24*time.Hour, now)).Should(BeTrue())
+		Ω(Lag{Found: true}.Stale(-1, time.Hour, now)).Should(BeFalse())
+
+		err := StaleError([]Lag{{Entry: Entry{Key: "resource_version_app"}}})
+		Ω(err).Should(MatchError(ErrStale))
+		Ω(err).Should(MatchError("snapshot contains stale versions: resource_version_app"))
+		Ω(StaleError(nil)).Should(BeNil())
+	})
+})
@@ -0,0 +1,49 @@
+package stopover
+
+import (
+	"github.com/concourse/concourse/atc"
+	"gopkg.in/yaml.v2"
+)
+
+// Marshal renders a snapshot as a versions file suitable for use with
+// `fly set-pipeline --load-vars-from`.
+func Marshal(snapshot *Snapshot) ([]byte, error) {
+	return yaml.Marshal(snapshot.Versions())
+}
+
+// Unmarshal parses a versions file. Only keys and versions are recorded in
+// the file, so entries have no Source and their Kind and Name are recovered
+// with ParseKey. The snapshot's Source and GeneratedAt are taken from the
+// header, if the file has one.
+func Unmarshal(data []byte) (*Snapshot, error) {
+	var file struct {
+		Header   *Header                `yaml:"stopover"`
+		Versions map[string]atc.Version `yaml:",inline"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{}
+	if file.Header != nil {
+		file.Header.apply(snapshot)
+		snapshot.Header = file.Header
+	}
+
+	for key, version := range file.Versions {
+		snapshot.Entries = append(snapshot.Entries, entryForKey(key, version))
+	}
+	snapshot.sort()
+
+	return snapshot, nil
+}
+
+func entryForKey(key string, version atc.Version) Entry {
+	kind, name := ParseKey(key)
+	return Entry{
+		Key:     key,
+		Kind:    kind,
+		Name:    name,
+		Version: version,
+	}
+}
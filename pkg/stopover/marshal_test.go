@@ -0,0 +1,130 @@
+package stopover_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/stopover"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"io/ioutil"
+	"time"
+
+	"github.com/concourse/concourse/atc"
+	"gopkg.in/yaml.v2"
+)
+
+var _ = Describe("Marshal", func() {
+	It("generates yaml that can be interpreted", func() {
+		snapshot := &Snapshot{
+			Entries: []Entry{
+				{Key: "resource1", Version: atc.Version{"ref": "sha1"}},
+				{Key: "resource2", Version: atc.Version{"ref": "sha1", "thing": "version-foo"}},
+			},
+		}
+
+		yamlBytes, err := Marshal(snapshot)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		actual := map[string]atc.Version{}
+		err = yaml.Unmarshal(yamlBytes, actual)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(actual).Should(Equal(map[string]atc.Version{
+			"resource1": {"ref": "sha1"},
+			"resource2": {"ref": "sha1", "thing": "version-foo"},
+		}))
+	})
+})
+
+var _ = Describe("Unmarshal", func() {
+	It("recovers entries from a versions file", func() {
+		bytes, err := ioutil.ReadFile("../../fixtures/expected_output.yml")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		snapshot, err := Unmarshal(bytes)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(snapshot.Entries).Should(HaveLen(4))
+		Ω(snapshot.Entries[0]).Should(Equal(Entry{
+			Key:     "resource_version_control-tower",
+			Kind:    KindInput,
+			Name:    "control-tower",
+			Version: atc.Version{"ref": "244a2df8b612d8e9b560ba73023d7673b5d4d007"},
+		}))
+
+		roundTripped, err := Marshal(snapshot)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(roundTripped).Should(MatchYAML(bytes))
+	})
+
+	It("keeps keys that were not written with the default naming", func() {
+		snapshot, err := Unmarshal([]byte("custom-key:\n  ref: abc\n"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(snapshot.Entries).Should(ConsistOf(Entry{
+			Key:     "custom-key",
+			Name:    "custom-key",
+			Version: atc.Version{"ref": "abc"},
+		}))
+	})
+})
+
+var _ = Describe("MarshalWithHeader", func() {
+	var snapshot *Snapshot
+
+	BeforeEach(func() {
+		snapshot = &Snapshot{
+			Source: Source{
+				URL:          "https://ci.example.com",
+				Team:         "main",
+				Pipeline:     "promote",
+				InstanceVars: atc.InstanceVars{"env": "prod"},
+				Job:          "deploy",
+				Build:        "42",
+				BuildID:      1234,
+			},
+			GeneratedAt: time.Date(2021, 6, 7, 12, 0, 0, 0, time.UTC),
+			Entries: []Entry{
+				{Key: "resource_version_app", Kind: KindInput, Name: "app", Version: atc.Version{"ref": "abc"}},
+			},
+		}
+	})
+
+	It("writes the header first", func() {
+		output, err := MarshalWithHeader(snapshot, NewHeader(snapshot, "1.2.3"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(string(output)).Should(Equal(`stopover:
+  schema_version: 1
+  atc: https://ci.example.com
+  team: main
+  pipeline: promote
+  instance_vars:
+    env: prod
+  job: deploy
+  build: "42"
+  build_id: 1234
+  generated_at: 2021-06-07T12:00:00Z
+  stopover_version: 1.2.3
+resource_version_app:
+  ref: abc
+`))
+	})
+
+	It("can be read back", func() {
+		header := NewHeader(snapshot, "1.2.3")
+		output, err := MarshalWithHeader(snapshot, header)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		read, err := Unmarshal(output)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(read.Header).Should(Equal(&header))
+
+		read.Header = nil
+		Ω(read).Should(Equal(snapshot))
+	})
+
+	It("remains loadable as vars", func() {
+		output, err := MarshalWithHeader(snapshot, NewHeader(snapshot, "1.2.3"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		vars := map[string]interface{}{}
+		Ω(yaml.Unmarshal(output, &vars)).Should(Succeed())
+		Ω(vars).Should(HaveKey("resource_version_app"))
+	})
+})
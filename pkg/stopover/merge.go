@@ -0,0 +1,98 @@
+package stopover
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/concourse/concourse/atc"
+)
+
+// Override is a change merged into a snapshot, recording where the new
+// version came from.
+type Override struct {
+	Change
+	From string `json:"from"`
+}
+
+func (o Override) String() string {
+	return fmt.Sprintf("%s (from %s)", o.Change, o.From)
+}
+
+// Merge returns a copy of base with the versions in overlay taking
+// precedence, along with the entries it changed. The source and header of
+// base are kept. from names overlay in the overrides, e.g. the file it was
+// read from. Keys that are not already in
+// base are an error unless allowNew is set.
+func Merge(base, overlay *Snapshot, from string, allowNew bool) (*Snapshot, []Override, error) {
+	merged := &Snapshot{Source: base.Source, GeneratedAt: base.GeneratedAt, Header: base.Header}
+	merged.Entries = append(merged.Entries, base.Entries...)
+
+	var overrides []Override
+	for _, entry := range overlay.Entries {
+		i := merged.index(entry.Key)
+		if i < 0 {
+			if !allowNew {
+				return nil, nil, fmt.Errorf("%s from %s is not in the base versions", entry.Key, from)
+			}
+
+			merged.Entries = append(merged.Entries, entry)
+			overrides = append(overrides, Override{Change: Change{Key: entry.Key, New: entry.Version}, From: from})
+			continue
+		}
+
+		old := merged.Entries[i].Version
+		if equalVersions(old, entry.Version) {
+			continue
+		}
+
+		merged.Entries[i] = entry
+		overrides = append(overrides, Override{Change: Change{Key: entry.Key, Old: old, New: entry.Version}, From: from})
+	}
+
+	merged.sort()
+	return merged, overrides, nil
+}
+
+func (s *Snapshot) index(key string) int {
+	for i, entry := range s.Entries {
+		if entry.Key == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// ParseSets builds a snapshot from KEY.FIELD=VALUE expressions, such as
+// resource_version_my-repo.ref=abc123. The expressions given for a key make
+// up the whole of its version, replacing any fields not mentioned.
+func ParseSets(sets []string) (*Snapshot, error) {
+	versions := map[string]atc.Version{}
+	for _, set := range sets {
+		equals := strings.Index(set, "=")
+		if equals < 0 {
+			return nil, fmt.Errorf("invalid set %q: expected KEY.FIELD=VALUE", set)
+		}
+
+		// Resource names may contain dots, so the field follows the last.
+		path, value := set[:equals], set[equals+1:]
+		dot := strings.LastIndex(path, ".")
+		if dot <= 0 || dot == len(path)-1 {
+			return nil, fmt.Errorf("invalid set %q: expected KEY.FIELD=VALUE", set)
+		}
+
+		key, field := path[:dot], path[dot+1:]
+		if versions[key] == nil {
+			versions[key] = atc.Version{}
+		}
+		versions[key][field] = value
+	}
+
+	snapshot := &Snapshot{}
+	for key, version := range versions {
+		snapshot.Entries = append(snapshot.Entries, entryForKey(key, version))
+	}
+	snapshot.sort()
+
+	return snapshot, nil
+}
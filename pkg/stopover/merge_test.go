@@ -0,0 +1,90 @@
+package stopover_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/stopover"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/concourse/atc"
+)
+
+var _ = Describe("Merge", func() {
+	var base *Snapshot
+
+	BeforeEach(func() {
+		base = &Snapshot{Entries: []Entry{
+			{Key: "resource_version_a", Version: atc.Version{"ref": "1"}},
+			{Key: "resource_version_b", Version: atc.Version{"ref": "1"}},
+		}}
+	})
+
+	It("overrides versions and reports the changes", func() {
+		overlay := &Snapshot{Entries: []Entry{
+			{Key: "resource_version_a", Version: atc.Version{"ref": "1"}},
+			{Key: "resource_version_b", Version: atc.Version{"ref": "2"}},
+		}}
+
+		merged, overrides, err := Merge(base, overlay, "hotfix.yml", false)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(merged.Versions()).Should(Equal(map[string]atc.Version{
+			"resource_version_a": {"ref": "1"},
+			"resource_version_b": {"ref": "2"},
+		}))
+		Ω(overrides).Should(HaveLen(1))
+		Ω(overrides[0].String()).Should(Equal("resource_version_b: {ref: 1} -> {ref: 2} (from hotfix.yml)"))
+		Ω(base.Versions()["resource_version_b"]).Should(Equal(atc.Version{"ref": "1"}))
+	})
+
+	It("keeps the base's source and header", func() {
+		base.Source = Source{Team: "main", Pipeline: "promote"}
+		base.Header = &Header{SchemaVersion: SchemaVersion, Team: "main", Pipeline: "promote", StopoverVersion: "1.2.3"}
+		overlay := &Snapshot{
+			Source:  Source{Team: "other"},
+			Header:  &Header{SchemaVersion: SchemaVersion, Team: "other"},
+			Entries: []Entry{{Key: "resource_version_a", Version: atc.Version{"ref": "2"}}},
+		}
+
+		merged, _, err := Merge(base, overlay, "hotfix.yml", false)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(merged.Source).Should(Equal(base.Source))
+		Ω(merged.Header).Should(Equal(base.Header))
+	})
+
+	It("refuses new keys unless allowed", func() {
+		overlay := &Snapshot{Entries: []Entry{{Key: "resource_version_c", Version: atc.Version{"ref": "1"}}}}
+
+		_, _, err := Merge(base, overlay, "extra.yml", false)
+		Ω(err).Should(MatchError("resource_version_c from extra.yml is not in the base versions"))
+
+		merged, overrides, err := Merge(base, overlay, "extra.yml", true)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(merged.Entries).Should(HaveLen(3))
+		Ω(overrides[0].String()).Should(Equal("resource_version_c: added {ref: 1} (from extra.yml)"))
+	})
+
+	Describe("ParseSets", func() {
+		It("builds each key's version from its fields", func() {
+			snapshot, err := ParseSets([]string{
+				"resource_version_my.repo.ref=abc",
+				"resource_version_my.repo.branch=main",
+				"output_version_image.digest=sha256:123=",
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshot.Versions()).Should(Equal(map[string]atc.Version{
+				"output_version_image":     {"digest": "sha256:123="},
+				"resource_version_my.repo": {"ref": "abc", "branch": "main"},
+			}))
+
+			entry, _ := snapshot.Lookup("resource_version_my.repo")
+			Ω(entry.Kind).Should(Equal(KindInput))
+			Ω(entry.Name).Should(Equal("my.repo"))
+		})
+
+		It("rejects malformed expressions", func() {
+			for _, set := range []string{"resource_version_a", "resource_version_a=1", ".ref=1", "resource_version_a.=1"} {
+				_, err := ParseSets([]string{set})
+				Ω(err).Should(MatchError(ContainSubstring("expected KEY.FIELD=VALUE")), set)
+			}
+		})
+	})
+})
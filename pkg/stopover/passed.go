@@ -0,0 +1,140 @@
+package stopover
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/concourse/concourse/atc"
+)
+
+// PassedResult records whether a snapshot entry's version passed one of the
+// jobs required of it.
+type PassedResult struct {
+	Entry Entry
+	Job   string
+	// Builds are the succeeded builds of Job that used the version as an
+	// input, most recent first.
+	Builds []atc.Build
+	// NotAnInput is set when Job does not get the entry's resource, so
+	// cannot be required of it.
+	NotAnInput bool
+	// Missing is set when the pipeline does not know the entry's version at
+	// all, so no build can have used it.
+	Missing bool
+}
+
+// Passed reports whether the version passed the job, or did not need to.
+func (r PassedResult) Passed() bool {
+	return r.NotAnInput || len(r.Builds) > 0
+}
+
+func (r PassedResult) String() string {
+	switch {
+	case r.NotAnInput:
+		return fmt.Sprintf("%s: %s does not get resource %s", r.Entry.Key, r.Job, r.Entry.Name)
+	case r.Missing:
+		return fmt.Sprintf("%s: version %s of resource %s is missing from the pipeline", r.Entry.Key, formatVersion(r.Entry.Version), r.Entry.Name)
+	case len(r.Builds) == 0:
+		return fmt.Sprintf("%s: no succeeded build of %s used version %s", r.Entry.Key, r.Job, formatVersion(r.Entry.Version))
+	}
+
+	var builds []string
+	for _, build := range r.Builds {
+		builds = append(builds, fmt.Sprintf("%s (global ID %d)", build.Name, build.ID))
+	}
+	noun := "build"
+	if len(builds) > 1 {
+		noun = "builds"
+	}
+	return fmt.Sprintf("%s: passed %s in %s %s", r.Entry.Key, r.Job, noun, strings.Join(builds, ", "))
+}
+
+// VerifyPassed checks that the version of every input and output in
+// snapshot was used by a succeeded build of each of jobs in the target
+// pipeline, as a `passed` constraint would require. Jobs that do not get a
+// resource are not required of it. Resource types and task images are
+// skipped, as no job gets them. If any version has not passed, the results
+// are returned with an error matching ErrNotPassed.
+func (t *Target) VerifyPassed(snapshot *Snapshot, jobs []string) ([]PassedResult, error) {
+	config, _, found, err := t.client.Team(t.team).PipelineConfig(t.pipeline)
+	if err != nil {
+		return nil, wrapClientErr("getting pipeline config", err)
+	}
+
+	if !found {
+		return nil, notFound(ErrPipelineNotFound, fmt.Sprintf("pipeline %q not found in team %q", t.pipeline.String(), t.team))
+	}
+
+	gets := map[string]map[string]bool{}
+	for _, job := range jobs {
+		jobConfig, found := config.Jobs.Lookup(job)
+		if !found {
+			return nil, notFound(ErrJobNotFound, fmt.Sprintf("job %q not found in pipeline %q", job, t.pipeline.String()))
+		}
+
+		gets[job] = map[string]bool{}
+		for _, input := range jobConfig.Inputs() {
+			gets[job][input.Resource] = true
+		}
+	}
+
+	var results []PassedResult
+	var gaps []string
+	for _, entry := range snapshot.Entries {
+		if entry.Kind == KindResourceType || entry.Kind == KindTaskImage {
+			continue
+		}
+
+		for _, job := range jobs {
+			result, err := t.passed(entry, job, gets[job][entry.Name])
+			if err != nil {
+				return results, err
+			}
+
+			results = append(results, result)
+			if !result.Passed() {
+				gaps = append(gaps, entry.Key+" has not passed "+job)
+			}
+		}
+	}
+
+	if len(gaps) > 0 {
+		return results, fmt.Errorf("%w: %s", ErrNotPassed, strings.Join(gaps, ", "))
+	}
+
+	return results, nil
+}
+
+func (t *Target) passed(entry Entry, job string, isInput bool) (PassedResult, error) {
+	result := PassedResult{Entry: entry, Job: job, NotAnInput: !isInput}
+	if !isInput {
+		return result, nil
+	}
+
+	version, found, err := t.FindVersion(entry.Name, entry.Version)
+	if err != nil {
+		return result, err
+	}
+
+	if !found {
+		result.Missing = true
+		return result, nil
+	}
+
+	builds, found, err := t.client.Team(t.team).BuildsWithVersionAsInput(t.pipeline, entry.Name, version.ID)
+	if err != nil {
+		return result, wrapClientErr("listing builds with "+entry.Key+" as an input", err)
+	}
+
+	if !found {
+		return result, notFound(ErrResourceNotFound, fmt.Sprintf("version %d of resource %q not found in pipeline %q", version.ID, entry.Name, t.pipeline.String()))
+	}
+
+	for _, build := range builds {
+		if build.JobName == job && build.Status == atc.StatusSucceeded {
+			result.Builds = append(result.Builds, build)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,114 @@
+package stopover_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/stopover"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/EngineerBetter/stopover/pkg/fakeatc"
+	"github.com/concourse/concourse/atc"
+)
+
+var _ = Describe("VerifyPassed", func() {
+	var fake *fakeatc.ATC
+	var target *Target
+	var snapshot *Snapshot
+
+	get := func(resources ...string) []atc.Step {
+		var steps []atc.Step
+		for _, resource := range resources {
+			steps = append(steps, atc.Step{Config: &atc.GetStep{Name: resource}})
+		}
+		return steps
+	}
+
+	BeforeEach(func() {
+		fake = fakeatc.New()
+		fake.SetPipelineConfig("main", "prod", atc.Config{
+			Jobs: atc.JobConfigs{
+				{Name: "test", PlanSequence: get("app", "image")},
+				{Name: "security-scan", PlanSequence: get("image")},
+			},
+		})
+
+		fake.AddBuild(atc.Build{TeamName: "main", PipelineName: "prod", JobName: "test", Name: "1", Status: atc.StatusSucceeded}, atc.BuildInputsOutputs{
+			Inputs: []atc.PublicBuildInput{
+				{Name: "app", Version: atc.Version{"ref": "aaa"}},
+				{Name: "image", Version: atc.Version{"digest": "sha256:111"}},
+			},
+		})
+		fake.AddBuild(atc.Build{TeamName: "main", PipelineName: "prod", JobName: "test", Name: "2", Status: atc.StatusFailed}, atc.BuildInputsOutputs{
+			Inputs: []atc.PublicBuildInput{
+				{Name: "app", Version: atc.Version{"ref": "bbb"}},
+				{Name: "image", Version: atc.Version{"digest": "sha256:111"}},
+			},
+		})
+		fake.AddBuild(atc.Build{TeamName: "main", PipelineName: "prod", JobName: "security-scan", Name: "1", Status: atc.StatusSucceeded}, atc.BuildInputsOutputs{
+			Inputs: []atc.PublicBuildInput{
+				{Name: "image", Version: atc.Version{"digest": "sha256:111"}},
+			},
+		})
+
+		target = NewTarget(fake.Client(), "main", atc.PipelineRef{Name: "prod"})
+		snapshot = &Snapshot{Entries: []Entry{
+			{Key: "resource_version_app", Kind: KindInput, Name: "app", Version: atc.Version{"ref": "aaa"}},
+			{Key: "resource_version_image", Kind: KindInput, Name: "image", Version: atc.Version{"digest": "sha256:111"}},
+			{Key: "task_image_version_unit", Kind: KindTaskImage, Name: "unit", Version: atc.Version{"digest": "sha256:222"}},
+		}}
+	})
+
+	AfterEach(func() {
+		fake.Close()
+	})
+
+	It("lists the succeeded builds of each required job that used each version", func() {
+		results, err := target.VerifyPassed(snapshot, []string{"test", "security-scan"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		var lines []string
+		for _, result := range results {
+			Ω(result.Passed()).Should(BeTrue())
+			lines = append(lines, result.String())
+		}
+		Ω(lines).Should(Equal([]string{
+			"resource_version_app: passed test in build 1 (global ID 1)",
+			"resource_version_app: security-scan does not get resource app",
+			"resource_version_image: passed test in build 1 (global ID 1)",
+			"resource_version_image: passed security-scan in build 1 (global ID 3)",
+		}))
+	})
+
+	It("reports versions that only failed required jobs", func() {
+		snapshot.Entries[0].Version = atc.Version{"ref": "bbb"}
+
+		results, err := target.VerifyPassed(snapshot, []string{"test"})
+		Ω(err).Should(MatchError(ErrNotPassed))
+		Ω(err).Should(MatchError(ContainSubstring("resource_version_app has not passed test")))
+		Ω(results).Should(HaveLen(2))
+		Ω(results[0].Passed()).Should(BeFalse())
+		Ω(results[0].String()).Should(Equal("resource_version_app: no succeeded build of test used version {ref: bbb}"))
+		Ω(results[1].Passed()).Should(BeTrue())
+	})
+
+	It("reports versions the pipeline has never seen", func() {
+		snapshot.Entries[0].Version = atc.Version{"ref": "ccc"}
+
+		results, err := target.VerifyPassed(snapshot, []string{"test"})
+		Ω(err).Should(MatchError(ErrNotPassed))
+		Ω(results[0].Builds).Should(BeEmpty())
+		Ω(results[0].Missing).Should(BeTrue())
+		Ω(results[0].String()).Should(Equal("resource_version_app: version {ref: ccc} of resource app is missing from the pipeline"))
+	})
+
+	It("fails for jobs missing from the pipeline", func() {
+		_, err := target.VerifyPassed(snapshot, []string{"deploy"})
+		Ω(err).Should(MatchError(ErrJobNotFound))
+		Ω(err).Should(MatchError(`job "deploy" not found in pipeline "prod"`))
+	})
+
+	It("fails for pipelines without a config", func() {
+		target = NewTarget(fake.Client(), "main", atc.PipelineRef{Name: "staging"})
+		_, err := target.VerifyPassed(snapshot, []string{"test"})
+		Ω(err).Should(MatchError(ErrPipelineNotFound))
+	})
+})
@@ -0,0 +1,89 @@
+package stopover
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/concourse/concourse/atc"
+)
+
+// StepResources maps the name of each get step in a build plan to the
+// resource it fetches, which differ when a step is aliased, e.g.
+// `get: src` with `resource: my-repo`. Steps whose name is used for more
+// than one resource are an error, as inputs cannot be told apart.
+func StepResources(plan atc.PublicBuildPlan) (map[string]string, error) {
+	resources := map[string]string{}
+	var err error
+	walkErr := walkPlan(plan, func(id, step string, fields map[string]interface{}) {
+		if step != "get" || err != nil {
+			return
+		}
+
+		name, _ := fields["name"].(string)
+		resource, _ := fields["resource"].(string)
+		if resource == "" {
+			resource = name
+		}
+
+		if existing, found := resources[name]; found && existing != resource {
+			err = fmt.Errorf("get step %q fetches both resource %q and resource %q", name, existing, resource)
+			return
+		}
+
+		resources[name] = resource
+	})
+
+	if walkErr != nil {
+		return nil, walkErr
+	}
+
+	return resources, err
+}
+
+// TaskSteps maps the ID of each task step in a build plan to the task's name.
+func TaskSteps(plan atc.PublicBuildPlan) (map[string]string, error) {
+	tasks := map[string]string{}
+	err := walkPlan(plan, func(id, step string, fields map[string]interface{}) {
+		if step == "task" {
+			tasks[id], _ = fields["name"].(string)
+		}
+	})
+
+	return tasks, err
+}
+
+// walkPlan calls visit with the ID, type and fields of every step in a public
+// build plan, descending into steps nested by do, in_parallel, across, try,
+// hooks and the like.
+func walkPlan(plan atc.PublicBuildPlan, visit func(id, step string, fields map[string]interface{})) error {
+	if plan.Plan == nil {
+		return nil
+	}
+
+	var tree interface{}
+	if err := json.Unmarshal(*plan.Plan, &tree); err != nil {
+		return fmt.Errorf("error parsing build plan [%v]", err)
+	}
+
+	walkNode(tree, visit)
+	return nil
+}
+
+func walkNode(node interface{}, visit func(id, step string, fields map[string]interface{})) {
+	switch node := node.(type) {
+	case []interface{}:
+		for _, child := range node {
+			walkNode(child, visit)
+		}
+
+	case map[string]interface{}:
+		id, _ := node["id"].(string)
+		for key, value := range node {
+			if fields, ok := value.(map[string]interface{}); ok {
+				visit(id, key, fields)
+			}
+
+			walkNode(value, visit)
+		}
+	}
+}
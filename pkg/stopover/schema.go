@@ -0,0 +1,116 @@
+package stopover
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/xeipuuv/gojsonschema"
+	"gopkg.in/yaml.v2"
+)
+
+// Schema is the JSON Schema for versions files.
+//
+//go:embed versions.schema.json
+var Schema []byte
+
+// Validate checks a versions file against Schema, returning a description of
+// each problem found. Files that are not YAML are an error.
+func Validate(data []byte) ([]string, error) {
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	value := jsonValue(document)
+	versions, isObject := value.(map[string]interface{})
+	if !isObject {
+		return validate(Schema, "", value)
+	}
+
+	// gojsonschema reports a value that does not match additionalProperties
+	// against the object containing it rather than the value's own key, so
+	// each version is validated on its own to be able to name it.
+	header := map[string]interface{}{}
+	if stopover, found := versions["stopover"]; found {
+		header["stopover"] = stopover
+	}
+
+	problems, err := validate(Schema, "", header)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema struct {
+		Version json.RawMessage `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		return nil, fmt.Errorf("error loading versions file schema [%v]", err)
+	}
+
+	keys := make([]string, 0, len(versions))
+	for key := range versions {
+		if key != "stopover" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		versionProblems, err := validate(schema.Version, key, versions[key])
+		if err != nil {
+			return nil, err
+		}
+
+		problems = append(problems, versionProblems...)
+	}
+
+	return problems, nil
+}
+
+// validate checks value against schema, naming each problem's field
+// relative to key.
+func validate(schema []byte, key string, value interface{}) ([]string, error) {
+	result, err := gojsonschema.Validate(gojsonschema.NewBytesLoader(schema), gojsonschema.NewGoLoader(value))
+	if err != nil {
+		return nil, fmt.Errorf("error validating versions file [%v]", err)
+	}
+
+	var problems []string
+	for _, resultErr := range result.Errors() {
+		field := resultErr.Field()
+		switch {
+		case key == "":
+		case field == gojsonschema.STRING_CONTEXT_ROOT:
+			field = key
+		default:
+			field = key + "." + field
+		}
+
+		problems = append(problems, fmt.Sprintf("%s: %s", field, resultErr.Description()))
+	}
+
+	return problems, nil
+}
+
+// jsonValue converts the maps decoded from YAML, which may have keys of any
+// type, to the string-keyed maps of JSON.
+func jsonValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(value))
+		for key, child := range value {
+			object[fmt.Sprint(key)] = jsonValue(child)
+		}
+		return object
+	case []interface{}:
+		array := make([]interface{}, len(value))
+		for i, child := range value {
+			array[i] = jsonValue(child)
+		}
+		return array
+	default:
+		return value
+	}
+}
@@ -0,0 +1,59 @@
+package stopover_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/stopover"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"io/ioutil"
+	"time"
+
+	"github.com/concourse/concourse/atc"
+)
+
+var _ = Describe("Validate", func() {
+	It("accepts versions files without a header", func() {
+		bytes, err := ioutil.ReadFile("../../fixtures/expected_output.yml")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		problems, err := Validate(bytes)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(problems).Should(BeEmpty())
+	})
+
+	It("accepts versions files with a header", func() {
+		snapshot := &Snapshot{
+			Source:      Source{URL: "https://ci.example.com", Team: "main", Pipeline: "promote", Job: "deploy", Build: "42", BuildID: 1234},
+			GeneratedAt: time.Now(),
+			Entries:     []Entry{{Key: "resource_version_app", Version: atc.Version{"ref": "abc"}}},
+		}
+		bytes, err := MarshalWithHeader(snapshot, NewHeader(snapshot, "dev"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		problems, err := Validate(bytes)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(problems).Should(BeEmpty())
+	})
+
+	It("reports versions that are not maps of strings", func() {
+		problems, err := Validate([]byte("resource_version_app:\n  ref: abc\n  nested:\n    a: b\nresource_version_empty: {}\n"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(problems).Should(ConsistOf(
+			"resource_version_app: Invalid type. Expected: string, given: object",
+			"resource_version_empty: Must have at least 1 properties",
+		))
+	})
+
+	It("reports headers from newer schema versions and unknown fields", func() {
+		problems, err := Validate([]byte("stopover:\n  schema_version: 2\n  colour: blue\nresource_version_app:\n  ref: abc\n"))
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(problems).Should(HaveLen(2))
+		Ω(problems).Should(ContainElement(HavePrefix("stopover.schema_version:")))
+		Ω(problems).Should(ContainElement(Equal("colour: Additional property colour is not allowed")))
+	})
+
+	It("fails on files that are not YAML", func() {
+		_, err := Validate([]byte("{"))
+		Ω(err).Should(HaveOccurred())
+	})
+})
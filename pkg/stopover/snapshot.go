@@ -0,0 +1,143 @@
+// Package stopover captures the resource versions used by a Concourse build
+// so that they can be replayed into other pipelines.
+package stopover
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/concourse/concourse/atc"
+)
+
+// Kind records where in a build an Entry came from.
+type Kind string
+
+const (
+	KindInput        Kind = "input"
+	KindOutput       Kind = "output"
+	KindResourceType Kind = "resource_type"
+	KindTaskImage    Kind = "task_image"
+)
+
+var kinds = []Kind{KindInput, KindOutput, KindResourceType, KindTaskImage}
+
+// Prefix is the default key prefix for entries of this kind.
+func (k Kind) Prefix() string {
+	switch k {
+	case KindInput:
+		return "resource_version_"
+	case KindOutput:
+		return "output_version_"
+	case KindResourceType:
+		return "resource_type_version_"
+	case KindTaskImage:
+		return "task_image_version_"
+	default:
+		return ""
+	}
+}
+
+// Source identifies the build a snapshot, or an entry, was taken from.
+type Source struct {
+	URL          string           `json:"url,omitempty"`
+	Team         string           `json:"team,omitempty"`
+	Pipeline     string           `json:"pipeline,omitempty"`
+	InstanceVars atc.InstanceVars `json:"instance_vars,omitempty"`
+	Job          string           `json:"job,omitempty"`
+	Build        string           `json:"build,omitempty"`
+	BuildID      int              `json:"build_id,omitempty"`
+	Status       string           `json:"status,omitempty"`
+	StartTime    time.Time        `json:"start_time,omitempty"`
+	EndTime      time.Time        `json:"end_time,omitempty"`
+}
+
+// PipelineRef returns the reference to the pipeline the source build ran in.
+func (s Source) PipelineRef() atc.PipelineRef {
+	return atc.PipelineRef{Name: s.Pipeline, InstanceVars: s.InstanceVars}
+}
+
+func sourceFromBuild(url string, build atc.Build) Source {
+	source := Source{
+		URL:          url,
+		Team:         build.TeamName,
+		Pipeline:     build.PipelineName,
+		InstanceVars: build.PipelineInstanceVars,
+		Job:          build.JobName,
+		Build:        build.Name,
+		BuildID:      build.ID,
+		Status:       string(build.Status),
+	}
+
+	if build.StartTime != 0 {
+		source.StartTime = time.Unix(build.StartTime, 0).UTC()
+	}
+
+	if build.EndTime != 0 {
+		source.EndTime = time.Unix(build.EndTime, 0).UTC()
+	}
+
+	return source
+}
+
+// Entry is a single resource version captured in a snapshot.
+type Entry struct {
+	// Key is the name the version is written under in a versions file.
+	Key     string      `json:"key"`
+	Kind    Kind        `json:"kind,omitempty"`
+	Name    string      `json:"name"`
+	Version atc.Version `json:"version"`
+	Source  Source      `json:"source,omitempty"`
+	// Step is the name of the get step that fetched an input, when it
+	// differs from the name of the resource.
+	Step string `json:"step,omitempty"`
+}
+
+// Snapshot is the set of resource versions used by a build.
+type Snapshot struct {
+	Source      Source    `json:"source,omitempty"`
+	GeneratedAt time.Time `json:"generated_at,omitempty"`
+	Entries     []Entry   `json:"entries"`
+	// Header is the header of the versions file the snapshot was read from,
+	// if it had one, so that it can be written back unchanged.
+	Header *Header `json:"-"`
+}
+
+// Versions returns the snapshot in versions file form, keyed by entry key.
+func (s *Snapshot) Versions() map[string]atc.Version {
+	versions := make(map[string]atc.Version, len(s.Entries))
+	for _, entry := range s.Entries {
+		versions[entry.Key] = entry.Version
+	}
+
+	return versions
+}
+
+// Lookup returns the entry with the given key.
+func (s *Snapshot) Lookup(key string) (Entry, bool) {
+	for _, entry := range s.Entries {
+		if entry.Key == key {
+			return entry, true
+		}
+	}
+
+	return Entry{}, false
+}
+
+func (s *Snapshot) sort() {
+	sort.Slice(s.Entries, func(i, j int) bool {
+		return s.Entries[i].Key < s.Entries[j].Key
+	})
+}
+
+// ParseKey recovers the kind and resource name from a key written with the
+// default key naming. Keys without a known prefix have an empty Kind.
+func ParseKey(key string) (Kind, string) {
+	for _, kind := range kinds {
+		if strings.HasPrefix(key, kind.Prefix()) {
+			return kind, strings.TrimPrefix(key, kind.Prefix())
+		}
+	}
+
+	return "", key
+}
@@ -0,0 +1,528 @@
+package stopover
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/concourse/concourse/atc"
+	"github.com/concourse/concourse/atc/event"
+	"github.com/concourse/concourse/go-concourse/concourse"
+)
+
+// KeyFunc names the key an entry is written under in a versions file.
+type KeyFunc func(Entry) string
+
+// DefaultKey prefixes the resource name according to the entry's kind, e.g.
+// resource_version_my-repo.
+func DefaultKey(entry Entry) string {
+	return entry.Kind.Prefix() + entry.Name
+}
+
+// Filter decides whether an entry is included in a snapshot.
+type Filter func(Entry) bool
+
+// Include keeps only entries whose resource name matches one of the given
+// path.Match patterns.
+func Include(patterns ...string) Filter {
+	return func(entry Entry) bool {
+		return matchesAny(entry.Name, patterns)
+	}
+}
+
+// Exclude drops entries whose resource name matches one of the given
+// path.Match patterns.
+func Exclude(patterns ...string) Filter {
+	return func(entry Entry) bool {
+		return !matchesAny(entry.Name, patterns)
+	}
+}
+
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// BuildRef identifies a job build, or any build by its global ID.
+type BuildRef struct {
+	Team     string
+	Pipeline atc.PipelineRef
+	Job      string
+	Build    string
+	// ID is the build's global ID. When set, the other fields are ignored,
+	// which allows one-off builds with no pipeline or job to be referred to.
+	ID int
+}
+
+// Snapshotter takes snapshots of builds.
+type Snapshotter struct {
+	client         concourse.Client
+	keyFunc        KeyFunc
+	filters        []Filter
+	includeOutputs bool
+	includeTypes   bool
+	stepNames      bool
+	taskImages     bool
+	now            func() time.Time
+}
+
+// Option configures a Snapshotter.
+type Option func(*Snapshotter)
+
+// WithClient sets the client used to talk to the ATC.
+func WithClient(client concourse.Client) Option {
+	return func(s *Snapshotter) {
+		s.client = client
+	}
+}
+
+// WithKeyFunc overrides DefaultKey.
+func WithKeyFunc(keyFunc KeyFunc) Option {
+	return func(s *Snapshotter) {
+		s.keyFunc = keyFunc
+	}
+}
+
+// WithFilter adds a filter. Entries must pass every filter to be included.
+func WithFilter(filter Filter) Option {
+	return func(s *Snapshotter) {
+		s.filters = append(s.filters, filter)
+	}
+}
+
+// WithOutputs includes the versions a build produced alongside its inputs.
+func WithOutputs() Option {
+	return func(s *Snapshotter) {
+		s.includeOutputs = true
+	}
+}
+
+// WithResourceTypes includes the versions of the pipeline's custom resource
+// types alongside the build's resources.
+func WithResourceTypes() Option {
+	return func(s *Snapshotter) {
+		s.includeTypes = true
+	}
+}
+
+// WithStepNames names inputs after the get step that fetched them, as the ATC
+// reports them, rather than resolving aliased steps to their resources using
+// the build plan.
+func WithStepNames() Option {
+	return func(s *Snapshotter) {
+		s.stepNames = true
+	}
+}
+
+// WithTaskImages includes the version of the image_resource each task in the
+// build ran with, named after the task.
+func WithTaskImages() Option {
+	return func(s *Snapshotter) {
+		s.taskImages = true
+	}
+}
+
+// WithClock overrides the clock used to stamp GeneratedAt.
+func WithClock(now func() time.Time) Option {
+	return func(s *Snapshotter) {
+		s.now = now
+	}
+}
+
+// NewSnapshotter returns a Snapshotter configured by opts. WithClient is
+// required.
+func NewSnapshotter(opts ...Option) *Snapshotter {
+	s := &Snapshotter{
+		keyFunc: DefaultKey,
+		now:     time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// LatestSucceeded may be given as a BuildRef's Build to select the most
+// recent succeeded build of the job.
+const LatestSucceeded = "latest-succeeded"
+
+// Snapshot captures the versions of the resources used by a job build.
+func (s *Snapshotter) Snapshot(ref BuildRef) (*Snapshot, error) {
+	build, err := s.ResolveBuild(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.SnapshotBuild(build)
+}
+
+// ResolveBuild looks up the build a BuildRef refers to.
+func (s *Snapshotter) ResolveBuild(ref BuildRef) (atc.Build, error) {
+	if ref.ID != 0 {
+		return s.buildByID(ref.ID)
+	}
+
+	team := s.client.Team(ref.Team)
+
+	if ref.Build == LatestSucceeded {
+		return s.latestSucceeded(team, ref)
+	}
+
+	build, found, err := team.JobBuild(ref.Pipeline, ref.Job, ref.Build)
+	if err != nil {
+		return atc.Build{}, wrapClientErr("getting build for job", err)
+	}
+
+	if !found {
+		return atc.Build{}, s.diagnoseNotFound(team, ref)
+	}
+
+	return build, nil
+}
+
+func (s *Snapshotter) buildByID(id int) (atc.Build, error) {
+	build, found, err := s.client.Build(strconv.Itoa(id))
+	if err != nil {
+		return atc.Build{}, wrapClientErr("getting build with global ID "+strconv.Itoa(id), err)
+	}
+
+	if !found {
+		return atc.Build{}, notFound(ErrBuildNotFound, "build with global ID "+strconv.Itoa(id)+" not found")
+	}
+
+	return build, nil
+}
+
+func (s *Snapshotter) latestSucceeded(team concourse.Team, ref BuildRef) (atc.Build, error) {
+	page := &concourse.Page{Limit: 100}
+	for page != nil {
+		builds, pagination, found, err := team.JobBuilds(ref.Pipeline, ref.Job, *page)
+		if err != nil {
+			return atc.Build{}, wrapClientErr("listing builds for job", err)
+		}
+
+		if !found {
+			return atc.Build{}, s.diagnoseNotFound(team, ref)
+		}
+
+		for _, build := range builds {
+			if build.Status == atc.StatusSucceeded {
+				return build, nil
+			}
+		}
+
+		page = pagination.Next
+	}
+
+	return atc.Build{}, notFound(ErrBuildNotFound, fmt.Sprintf("no succeeded build found for job %q in pipeline %q", ref.Job, ref.Pipeline.String()))
+}
+
+// SnapshotBuild captures the versions of the resources used by a build that
+// has already been looked up.
+func (s *Snapshotter) SnapshotBuild(build atc.Build) (*Snapshot, error) {
+	globalID := build.ID
+	buildInputsOutputs, found, err := s.client.BuildResources(globalID)
+	if err != nil {
+		return nil, wrapClientErr("getting resources for build with global ID "+strconv.Itoa(globalID), err)
+	}
+
+	if !found {
+		return nil, notFound(ErrBuildNotFound, "could not get resources for build with global ID "+strconv.Itoa(globalID))
+	}
+
+	snapshot := &Snapshot{
+		Source:      sourceFromBuild(s.client.URL(), build),
+		GeneratedAt: s.now().UTC(),
+	}
+
+	var plan atc.PublicBuildPlan
+	if !s.stepNames || s.taskImages {
+		plan, err = s.BuildPlan(globalID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	inputs, err := s.inputEntries(plan, buildInputsOutputs.Inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range inputs {
+		s.add(snapshot, entry)
+	}
+
+	if s.includeOutputs {
+		for _, output := range buildInputsOutputs.Outputs {
+			s.add(snapshot, Entry{Kind: KindOutput, Name: output.Name, Version: output.Version})
+		}
+	}
+
+	// One-off builds have no pipeline to look up resource types in.
+	if s.includeTypes && snapshot.Source.Pipeline != "" {
+		if err := s.addResourceTypes(snapshot); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.taskImages {
+		images, err := s.TaskImages(globalID, plan)
+		if err != nil {
+			return nil, err
+		}
+
+		for task, version := range images {
+			s.add(snapshot, Entry{Kind: KindTaskImage, Name: task, Version: version})
+		}
+	}
+
+	snapshot.sort()
+	return snapshot, nil
+}
+
+// inputEntries names each input after the resource it fetched, looking up
+// aliased get steps in the build plan. Several steps fetching the same
+// version of a resource become one entry; different versions are an error.
+func (s *Snapshotter) inputEntries(plan atc.PublicBuildPlan, inputs []atc.PublicBuildInput) ([]Entry, error) {
+	resources := map[string]string{}
+	if !s.stepNames {
+		var err error
+		resources, err = StepResources(plan)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []Entry
+	seen := map[string]Entry{}
+	for _, input := range inputs {
+		entry := Entry{Kind: KindInput, Name: input.Name, Version: input.Version}
+		if resource, found := resources[input.Name]; found && resource != input.Name {
+			entry.Name = resource
+			entry.Step = input.Name
+		}
+
+		if existing, found := seen[entry.Name]; found {
+			if !equalVersions(existing.Version, entry.Version) {
+				return nil, fmt.Errorf("resource %q is fetched at different versions by steps %q and %q", entry.Name, stepName(existing), stepName(entry))
+			}
+			continue
+		}
+
+		seen[entry.Name] = entry
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func stepName(entry Entry) string {
+	if entry.Step != "" {
+		return entry.Step
+	}
+
+	return entry.Name
+}
+
+// TaskImages reads a finished build's events to find the version of the
+// image_resource fetched for each task in plan, keyed by task name. Tasks
+// using an image from a get step are not included, as that step is already
+// one of the build's inputs.
+func (s *Snapshotter) TaskImages(buildID int, plan atc.PublicBuildPlan) (map[string]atc.Version, error) {
+	tasks, err := TaskSteps(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	images := map[string]atc.Version{}
+	if len(tasks) == 0 {
+		return images, nil
+	}
+
+	op := "streaming events for build with global ID " + strconv.Itoa(buildID)
+	events, err := s.client.BuildEvents(strconv.Itoa(buildID))
+	if err != nil {
+		return nil, wrapClientErr(op, err)
+	}
+	defer events.Close()
+
+	// Image fetches are announced against the task's plan ID, then run as
+	// a get step with a plan ID of their own.
+	imageGets := map[string]string{}
+	for {
+		ev, err := events.NextEvent()
+		if err == io.EOF {
+			return images, nil
+		}
+		if err != nil {
+			return nil, wrapClientErr(op, err)
+		}
+
+		switch e := ev.(type) {
+		case event.ImageGet:
+			task, found := tasks[string(e.Origin.ID)]
+			if !found || e.PublicPlan == nil {
+				continue
+			}
+
+			var get struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(*e.PublicPlan, &get); err != nil {
+				return nil, fmt.Errorf("error parsing image plan of task %q [%v]", task, err)
+			}
+			imageGets[get.ID] = task
+
+		case event.FinishGet:
+			task, found := imageGets[string(e.Origin.ID)]
+			if !found || e.ExitStatus != 0 {
+				continue
+			}
+
+			if existing, found := images[task]; found && !equalVersions(existing, e.FetchedVersion) {
+				return nil, fmt.Errorf("task %q ran with image versions %s and %s", task, formatVersion(existing), formatVersion(e.FetchedVersion))
+			}
+			images[task] = e.FetchedVersion
+
+		case event.Status:
+			if !(atc.Build{Status: e.Status}).IsRunning() {
+				return images, nil
+			}
+		}
+	}
+}
+
+// addResourceTypes adds the version each of the pipeline's custom resource
+// types is on. Concourse does not record the version a build ran with, so
+// this is the latest version, which may be newer if the type has moved on
+// since the build.
+func (s *Snapshotter) addResourceTypes(snapshot *Snapshot) error {
+	source := snapshot.Source
+	types, found, err := s.client.Team(source.Team).VersionedResourceTypes(source.PipelineRef())
+	if err != nil {
+		return wrapClientErr("getting resource types", err)
+	}
+
+	if !found {
+		return notFound(ErrPipelineNotFound, fmt.Sprintf("pipeline %q not found in team %q", source.PipelineRef().String(), source.Team))
+	}
+
+	for _, resourceType := range types {
+		// Types that have never been checked have no version to record.
+		if resourceType.Version == nil {
+			continue
+		}
+
+		s.add(snapshot, Entry{Kind: KindResourceType, Name: resourceType.Name, Version: resourceType.Version})
+	}
+
+	return nil
+}
+
+func (s *Snapshotter) add(snapshot *Snapshot, entry Entry) {
+	entry.Source = snapshot.Source
+	entry.Key = s.keyFunc(entry)
+
+	for _, filter := range s.filters {
+		if !filter(entry) {
+			return
+		}
+	}
+
+	snapshot.Entries = append(snapshot.Entries, entry)
+}
+
+// diagnoseNotFound works out which of the team, pipeline, job or build was
+// missing when a JobBuild lookup comes back empty. It only asks the team's own
+// routes, which the ATC answers with 404 when the team does not exist, so that
+// tokens that cannot list every team are diagnosed too.
+func (s *Snapshotter) diagnoseNotFound(team concourse.Team, ref BuildRef) error {
+	_, found, err := team.Pipeline(ref.Pipeline)
+	if err != nil {
+		return wrapClientErr("getting pipeline", err)
+	}
+
+	if !found {
+		// The pipeline lookup cannot tell a missing team from a missing
+		// pipeline, but listing the pipelines of a missing team fails.
+		if _, err := team.ListPipelines(); err != nil {
+			if err := wrapClientErr("listing pipelines", err); errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden) {
+				return err
+			}
+
+			return notFound(ErrTeamNotFound, fmt.Sprintf("team %q not found", ref.Team))
+		}
+
+		return notFound(ErrPipelineNotFound, fmt.Sprintf("pipeline %q not found in team %q", ref.Pipeline.String(), ref.Team))
+	}
+
+	_, found, err = team.Job(ref.Pipeline, ref.Job)
+	if err != nil {
+		return wrapClientErr("getting job", err)
+	}
+
+	if !found {
+		return notFound(ErrJobNotFound, fmt.Sprintf("job %q not found in pipeline %q", ref.Job, ref.Pipeline.String()))
+	}
+
+	return notFound(ErrBuildNotFound, fmt.Sprintf("build %q not found for job %q in pipeline %q", ref.Build, ref.Job, ref.Pipeline.String()))
+}
+
+// Complete reports whether snapshots record every version their builds
+// fetched: resource types and task images as well as inputs, with none
+// filtered out.
+func (s *Snapshotter) Complete() bool {
+	return s.includeTypes && s.taskImages && len(s.filters) == 0
+}
+
+// DisabledVersions returns the entries of snapshot whose versions have been
+// disabled in the pipeline it was taken from, and those it could not check,
+// as Target.DisabledVersions does. Snapshots of one-off builds have no
+// pipeline, and so no disabled versions.
+func (s *Snapshotter) DisabledVersions(snapshot *Snapshot) (disabled, unknown []Entry, err error) {
+	if snapshot.Source.Pipeline == "" {
+		return nil, nil, nil
+	}
+
+	return NewTarget(s.client, snapshot.Source.Team, snapshot.Source.PipelineRef()).DisabledVersions(snapshot)
+}
+
+// PipelineConfig fetches the config of the pipeline a snapshot was taken
+// from, e.g. to look up the type and source of its resources.
+func (s *Snapshotter) PipelineConfig(team string, pipeline atc.PipelineRef) (atc.Config, error) {
+	config, _, found, err := s.client.Team(team).PipelineConfig(pipeline)
+	if err != nil {
+		return atc.Config{}, wrapClientErr("getting pipeline config", err)
+	}
+
+	if !found {
+		return atc.Config{}, notFound(ErrPipelineNotFound, fmt.Sprintf("pipeline %q not found in team %q", pipeline.String(), team))
+	}
+
+	return config, nil
+}
+
+// BuildPlan fetches the plan a build ran, as shown in the Concourse web UI.
+func (s *Snapshotter) BuildPlan(buildID int) (atc.PublicBuildPlan, error) {
+	plan, found, err := s.client.BuildPlan(buildID)
+	if err != nil {
+		return atc.PublicBuildPlan{}, wrapClientErr("getting plan for build with global ID "+strconv.Itoa(buildID), err)
+	}
+
+	if !found {
+		return atc.PublicBuildPlan{}, notFound(ErrBuildNotFound, "could not get plan for build with global ID "+strconv.Itoa(buildID))
+	}
+
+	return plan, nil
+}
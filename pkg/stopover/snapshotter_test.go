@@ -0,0 +1,591 @@
+package stopover_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/stopover"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/fakeatc"
+	"github.com/concourse/concourse/atc"
+	"github.com/concourse/concourse/atc/event"
+	"github.com/concourse/concourse/go-concourse/concourse"
+	"github.com/concourse/concourse/go-concourse/concourse/concoursefakes"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var _ = Describe("Snapshotter", func() {
+
+	var teamName = "main"
+	var pipelineName = "control-tower"
+	var jobName = "minor"
+	var buildName = "1"
+
+	var expectedStruct map[string]atc.Version
+	var client *concoursefakes.FakeClient
+	var plan string
+
+	BeforeEach(func() {
+		expectedStruct = map[string]atc.Version{}
+		expectedBytes, err := ioutil.ReadFile("../../fixtures/expected_output.yml")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(expectedBytes).ShouldNot(BeEmpty())
+		err = yaml.Unmarshal(expectedBytes, expectedStruct)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fakeTeam := new(concoursefakes.FakeTeam)
+		fakeTeam.NameReturns("main")
+		fakeTeam.PipelineStub = func(pipeline atc.PipelineRef) (atc.Pipeline, bool, error) {
+			return atc.Pipeline{Name: pipeline.Name}, pipeline.Name == "control-tower", nil
+		}
+		fakeTeam.PipelineConfigStub = func(pipeline atc.PipelineRef) (atc.Config, string, bool, error) {
+			if pipeline.Name != "control-tower" {
+				return atc.Config{}, "", false, nil
+			}
+
+			return atc.Config{Resources: atc.ResourceConfigs{{Name: "version", Type: "semver"}}}, "1", true, nil
+		}
+		fakeTeam.VersionedResourceTypesReturns(atc.VersionedResourceTypes{
+			{ResourceType: atc.ResourceType{Name: "slack-notification", Type: "registry-image"}, Version: atc.Version{"digest": "sha256:abc"}},
+			{ResourceType: atc.ResourceType{Name: "unchecked", Type: "registry-image"}},
+		}, true, nil)
+		fakeTeam.JobStub = func(pipeline atc.PipelineRef, job string) (atc.Job, bool, error) {
+			return atc.Job{Name: job}, job == "minor", nil
+		}
+		fakeTeam.JobBuildStub = func(pipeline atc.PipelineRef, job, build string) (atc.Build, bool, error) {
+			if pipeline.Name == "control-tower" && job == "minor" && build == "1" {
+				return atc.Build{
+					ID:           2098,
+					TeamName:     "main",
+					Name:         "1",
+					Status:       atc.StatusSucceeded,
+					JobName:      "minor",
+					PipelineName: "control-tower",
+					StartTime:    1552389802,
+					EndTime:      1552389883,
+				}, true, nil
+			}
+
+			return atc.Build{}, false, nil
+		}
+
+		wrongTeam := new(concoursefakes.FakeTeam)
+		wrongTeam.NameReturns("does-not-exist")
+		wrongTeam.JobBuildStub = func(pipeline atc.PipelineRef, job, build string) (atc.Build, bool, error) {
+			return atc.Build{}, false, nil
+		}
+		wrongTeam.ListPipelinesReturns(nil, errors.New("resource not found"))
+
+		client = new(concoursefakes.FakeClient)
+		client.URLReturns("https://ci.example.com")
+		client.TeamStub = func(teamName string) concourse.Team {
+			if teamName == "main" {
+				return fakeTeam
+			}
+
+			return wrongTeam
+		}
+
+		plan = `{"id":"1","on_success":{"step":{"id":"2","do":[
+			{"id":"3","in_parallel":{"steps":[
+				{"id":"4","get":{"name":"control-tower-ops","type":"git","resource":"control-tower-ops"}},
+				{"id":"5","get":{"name":"pcf-ops","type":"registry-image","resource":"pcf-ops"}},
+				{"id":"6","get":{"name":"version","type":"semver","resource":"version"}}
+			]}},
+			{"id":"7","try":{"step":{"id":"8","get":{"name":"control-tower","type":"git","resource":"control-tower"}}}},
+			{"id":"9","task":{"name":"build","privileged":false}}
+		]},"on_success":{"id":"10","put":{"name":"version","type":"semver","resource":"version"}}}}`
+		client.BuildPlanStub = func(buildID int) (atc.PublicBuildPlan, bool, error) {
+			raw := json.RawMessage(plan)
+			return atc.PublicBuildPlan{Schema: "exec.v2", Plan: &raw}, buildID == 2098, nil
+		}
+
+		client.BuildResourcesStub = func(buildID int) (atc.BuildInputsOutputs, bool, error) {
+			if buildID == 2098 {
+				return atc.BuildInputsOutputs{
+					Inputs: []atc.PublicBuildInput{
+						{
+							Name: "control-tower-ops",
+							Version: atc.Version{
+								"commit": "407f8ab92a7258cbae32d1ad987b64f8d18a9a3a",
+								"ref":    "0.0.8",
+							},
+						},
+						{
+							Name: "pcf-ops",
+							Version: atc.Version{
+								"digest": "sha256:8a4f9f1647080c224f015cc655146fda7329baa8c7b279b597dee114a69ff97a",
+							},
+						},
+						{
+							Name: "version",
+							Version: atc.Version{
+								"number": "0.2.0",
+							},
+						},
+						{
+							Name: "control-tower",
+							Version: atc.Version{
+								"ref": "244a2df8b612d8e9b560ba73023d7673b5d4d007",
+							},
+						},
+					},
+					Outputs: []atc.PublicBuildOutput{
+						{
+							Name:    "version",
+							Version: atc.Version{"number": "0.2.1"},
+						},
+					},
+				}, true, nil
+			}
+
+			return atc.BuildInputsOutputs{}, false, nil
+		}
+	})
+
+	It("returns the expected stuff", func() {
+		snapshot, err := takeSnapshot(client, teamName, pipelineName, jobName, buildName)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(snapshot.Versions()).Should(Equal(expectedStruct))
+	})
+
+	It("records where each entry came from", func() {
+		snapshot, err := NewSnapshotter(
+			WithClient(client),
+			WithClock(func() time.Time { return time.Unix(1600000000, 0) }),
+		).Snapshot(BuildRef{Team: teamName, Pipeline: atc.PipelineRef{Name: pipelineName}, Job: jobName, Build: buildName})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		expectedSource := Source{
+			URL:       "https://ci.example.com",
+			Team:      "main",
+			Pipeline:  "control-tower",
+			Job:       "minor",
+			Build:     "1",
+			BuildID:   2098,
+			Status:    "succeeded",
+			StartTime: time.Unix(1552389802, 0).UTC(),
+			EndTime:   time.Unix(1552389883, 0).UTC(),
+		}
+		Ω(snapshot.Source).Should(Equal(expectedSource))
+		Ω(snapshot.GeneratedAt).Should(Equal(time.Unix(1600000000, 0).UTC()))
+		Ω(snapshot.Entries[0]).Should(Equal(Entry{
+			Key:     "resource_version_control-tower",
+			Kind:    KindInput,
+			Name:    "control-tower",
+			Version: atc.Version{"ref": "244a2df8b612d8e9b560ba73023d7673b5d4d007"},
+			Source:  expectedSource,
+		}))
+	})
+
+	Context("with options", func() {
+		var opts []Option
+
+		BeforeEach(func() {
+			opts = []Option{WithClient(client)}
+		})
+
+		snapshotWith := func(extra ...Option) map[string]atc.Version {
+			snapshot, err := NewSnapshotter(append(opts, extra...)...).Snapshot(BuildRef{
+				Team:     teamName,
+				Pipeline: atc.PipelineRef{Name: pipelineName},
+				Job:      jobName,
+				Build:    buildName,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			return snapshot.Versions()
+		}
+
+		It("includes outputs when asked", func() {
+			versions := snapshotWith(WithOutputs())
+			Ω(versions).Should(HaveKeyWithValue("output_version_version", atc.Version{"number": "0.2.1"}))
+			Ω(versions).Should(HaveKeyWithValue("resource_version_version", atc.Version{"number": "0.2.0"}))
+		})
+
+		It("includes resource types when asked", func() {
+			versions := snapshotWith(WithResourceTypes())
+			Ω(versions).Should(HaveKeyWithValue("resource_type_version_slack-notification", atc.Version{"digest": "sha256:abc"}))
+			Ω(versions).ShouldNot(HaveKey("resource_type_version_unchecked"))
+			Ω(versions).Should(HaveKey("resource_version_version"))
+		})
+
+		It("applies filters", func() {
+			versions := snapshotWith(WithFilter(Include("control-tower*")), WithFilter(Exclude("*-ops")))
+			Ω(versions).Should(HaveLen(1))
+			Ω(versions).Should(HaveKey("resource_version_control-tower"))
+		})
+
+		It("uses a custom key function", func() {
+			versions := snapshotWith(WithKeyFunc(func(entry Entry) string {
+				return "v_" + entry.Name
+			}))
+			Ω(versions).Should(HaveKey("v_pcf-ops"))
+			Ω(versions).ShouldNot(HaveKey("resource_version_pcf-ops"))
+		})
+	})
+
+	Context("when get steps are aliased", func() {
+		BeforeEach(func() {
+			plan = strings.Replace(plan, `"name":"control-tower","type":"git","resource":"control-tower"`, `"name":"src","type":"git","resource":"control-tower"`, 1)
+			plan = strings.Replace(plan, `"name":"version","type":"semver","resource":"version"`, `"name":"current-version","type":"semver","resource":"version"`, 1)
+			resources, _, _ := client.BuildResources(2098)
+			resources.Inputs[2].Name = "current-version"
+			resources.Inputs[3].Name = "src"
+			client.BuildResourcesStub = nil
+			client.BuildResourcesReturns(resources, true, nil)
+		})
+
+		It("names inputs after their resources", func() {
+			snapshot, err := takeSnapshot(client, teamName, pipelineName, jobName, buildName)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshot.Versions()).Should(Equal(expectedStruct))
+
+			entry, found := snapshot.Lookup("resource_version_control-tower")
+			Ω(found).Should(BeTrue())
+			Ω(entry.Step).Should(Equal("src"))
+		})
+
+		It("names inputs after their steps when asked", func() {
+			snapshot, err := NewSnapshotter(WithClient(client), WithStepNames()).Snapshot(BuildRef{
+				Team:     teamName,
+				Pipeline: atc.PipelineRef{Name: pipelineName},
+				Job:      jobName,
+				Build:    buildName,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshot.Versions()).Should(HaveKey("resource_version_src"))
+			Ω(snapshot.Versions()).Should(HaveKey("resource_version_current-version"))
+			Ω(client.BuildPlanCallCount()).Should(Equal(0))
+		})
+
+		It("resolves step names to resources when checking for disabled versions", func() {
+			snapshotter := NewSnapshotter(WithClient(client), WithStepNames())
+			snapshot, err := snapshotter.Snapshot(BuildRef{
+				Team:     teamName,
+				Pipeline: atc.PipelineRef{Name: pipelineName},
+				Job:      jobName,
+				Build:    buildName,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeTeam := client.Team(teamName).(*concoursefakes.FakeTeam)
+			fakeTeam.ResourceVersionsStub = func(pipeline atc.PipelineRef, resource string, page concourse.Page, filter atc.Version) ([]atc.ResourceVersion, concourse.Pagination, bool, error) {
+				if resource == "src" || resource == "current-version" {
+					return nil, concourse.Pagination{}, false, nil
+				}
+				return []atc.ResourceVersion{{Version: filter, Enabled: resource != "control-tower"}}, concourse.Pagination{}, true, nil
+			}
+			fakeTeam.PipelineConfigStub = func(pipeline atc.PipelineRef) (atc.Config, string, bool, error) {
+				return atc.Config{Jobs: atc.JobConfigs{{Name: jobName, PlanSequence: []atc.Step{
+					{Config: &atc.GetStep{Name: "src", Resource: "control-tower"}},
+				}}}}, "1", true, nil
+			}
+
+			disabled, unknown, err := snapshotter.DisabledVersions(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(disabled).Should(HaveLen(1))
+			Ω(disabled[0].Key).Should(Equal("resource_version_src"))
+			Ω(unknown).Should(HaveLen(1))
+			Ω(unknown[0].Key).Should(Equal("resource_version_current-version"))
+			Ω(fakeTeam.PipelineConfigCallCount()).Should(Equal(1))
+		})
+
+		It("refuses resources fetched at different versions", func() {
+			plan = strings.Replace(plan, `"name":"pcf-ops","type":"registry-image","resource":"pcf-ops"`, `"name":"pcf-ops","type":"git","resource":"control-tower"`, 1)
+
+			_, err := takeSnapshot(client, teamName, pipelineName, jobName, buildName)
+			Ω(err).Should(MatchError(`resource "control-tower" is fetched at different versions by steps "pcf-ops" and "src"`))
+		})
+
+		It("refuses step names used for more than one resource", func() {
+			_, err := StepResources(atc.PublicBuildPlan{Plan: rawPlan(`{"do":[
+				{"get":{"name":"src","resource":"a"}},
+				{"get":{"name":"src","resource":"b"}}
+			]}`)})
+			Ω(err).Should(MatchError(ContainSubstring(`get step "src" fetches both`)))
+		})
+	})
+
+	Context("capturing task images", func() {
+		var events []atc.Event
+
+		imageGet := func(task, get string) event.ImageGet {
+			return event.ImageGet{Origin: event.Origin{ID: event.OriginID(task)}, PublicPlan: rawPlan(`{"id":"` + get + `","get":{"name":"image","type":"registry-image"}}`)}
+		}
+
+		finishGet := func(get string, exitStatus int, digest string) event.FinishGet {
+			return event.FinishGet{Origin: event.Origin{ID: event.OriginID(get)}, ExitStatus: exitStatus, FetchedVersion: atc.Version{"digest": digest}}
+		}
+
+		BeforeEach(func() {
+			events = []atc.Event{
+				imageGet("9", "9/image-get"),
+				finishGet("4", 0, "sha256:not-an-image"),
+				finishGet("9/image-get", 0, "sha256:abc"),
+				event.Status{Status: atc.StatusSucceeded},
+			}
+			client.BuildEventsStub = func(buildID string) (concourse.Events, error) {
+				return &fakeEvents{events: events}, nil
+			}
+		})
+
+		snapshotWithImages := func() (*Snapshot, error) {
+			return NewSnapshotter(WithClient(client), WithTaskImages()).Snapshot(BuildRef{
+				Team:     teamName,
+				Pipeline: atc.PipelineRef{Name: pipelineName},
+				Job:      jobName,
+				Build:    buildName,
+			})
+		}
+
+		It("records the image each task ran with", func() {
+			snapshot, err := snapshotWithImages()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshot.Versions()).Should(HaveKeyWithValue("task_image_version_build", atc.Version{"digest": "sha256:abc"}))
+			Ω(snapshot.Versions()).Should(HaveLen(5))
+			Ω(client.BuildEventsArgsForCall(0)).Should(Equal("2098"))
+		})
+
+		It("ignores failed image fetches", func() {
+			events[2] = finishGet("9/image-get", 1, "sha256:abc")
+
+			snapshot, err := snapshotWithImages()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshot.Versions()).ShouldNot(HaveKey("task_image_version_build"))
+		})
+
+		It("refuses tasks that ran with different images", func() {
+			events = append([]atc.Event{imageGet("9", "9/retry"), finishGet("9/retry", 0, "sha256:def")}, events...)
+
+			_, err := snapshotWithImages()
+			Ω(err).Should(MatchError(`task "build" ran with image versions {digest: sha256:def} and {digest: sha256:abc}`))
+		})
+	})
+
+	Context("when given a global build ID", func() {
+		BeforeEach(func() {
+			client.BuildStub = func(id string) (atc.Build, bool, error) {
+				build, _, _ := client.Team("main").JobBuild(atc.PipelineRef{Name: pipelineName}, jobName, buildName)
+				return build, id == "2098", nil
+			}
+		})
+
+		It("snapshots the build without looking up its job", func() {
+			snapshot, err := NewSnapshotter(WithClient(client)).Snapshot(BuildRef{ID: 2098})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshot.Versions()).Should(Equal(expectedStruct))
+			Ω(snapshot.Source.Job).Should(Equal("minor"))
+		})
+
+		It("returns ErrBuildNotFound for unknown IDs", func() {
+			_, err := NewSnapshotter(WithClient(client)).Snapshot(BuildRef{ID: 1})
+			Ω(err).Should(MatchError(ErrBuildNotFound))
+			Ω(err).Should(MatchError("build with global ID 1 not found"))
+		})
+
+		It("snapshots one-off builds", func() {
+			client.BuildReturns(atc.Build{ID: 2098, TeamName: "main", Name: "2098", Status: atc.StatusSucceeded}, true, nil)
+			client.BuildStub = nil
+
+			snapshotter := NewSnapshotter(WithClient(client), WithResourceTypes())
+			snapshot, err := snapshotter.Snapshot(BuildRef{ID: 2098})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshot.Source.Pipeline).Should(BeEmpty())
+			Ω(snapshot.Versions()).Should(Equal(expectedStruct))
+
+			disabled, _, err := snapshotter.DisabledVersions(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(disabled).Should(BeEmpty())
+		})
+	})
+
+	Context("when the team does not exist", func() {
+		It("says which team was missing", func() {
+			_, err := takeSnapshot(client, "does-not-exist", pipelineName, jobName, buildName)
+			Ω(err).Should(MatchError(`team "does-not-exist" not found`))
+		})
+
+		It("returns ErrTeamNotFound", func() {
+			snapshot, err := takeSnapshot(client, "does-not-exist", pipelineName, jobName, buildName)
+			Ω(err).Should(MatchError(ErrTeamNotFound))
+			Ω(snapshot).Should(BeNil())
+		})
+
+		It("returns ErrForbidden when the token cannot see the team", func() {
+			client.Team("does-not-exist").(*concoursefakes.FakeTeam).ListPipelinesReturns(nil, concourse.ErrForbidden)
+
+			_, err := takeSnapshot(client, "does-not-exist", pipelineName, jobName, buildName)
+			Ω(err).Should(MatchError(ErrForbidden))
+		})
+	})
+
+	Context("when the pipeline does not exist", func() {
+		It("returns ErrPipelineNotFound", func() {
+			snapshot, err := takeSnapshot(client, teamName, "does-not-exist", jobName, buildName)
+			Ω(err).Should(MatchError(ErrPipelineNotFound))
+			Ω(snapshot).Should(BeNil())
+		})
+
+		It("does not list every team", func() {
+			_, err := takeSnapshot(client, teamName, "does-not-exist", jobName, buildName)
+			Ω(err).Should(MatchError(ErrPipelineNotFound))
+			Ω(client.ListTeamsCallCount()).Should(Equal(0))
+		})
+	})
+
+	Context("when diagnosing missing builds against an ATC", func() {
+		It("tells missing teams from missing pipelines using the team's routes", func() {
+			fake := fakeatc.New()
+			defer fake.Close()
+			fake.AddBuild(atc.Build{TeamName: "main", PipelineName: "promote", JobName: "snapshot", Name: "1", Status: atc.StatusSucceeded}, atc.BuildInputsOutputs{})
+			snapshotter := NewSnapshotter(WithClient(fake.Client()))
+
+			_, err := snapshotter.Snapshot(BuildRef{Team: "main", Pipeline: atc.PipelineRef{Name: "missing"}, Job: "snapshot", Build: "1"})
+			Ω(err).Should(MatchError(ErrPipelineNotFound))
+
+			_, err = snapshotter.Snapshot(BuildRef{Team: "missing", Pipeline: atc.PipelineRef{Name: "promote"}, Job: "snapshot", Build: "1"})
+			Ω(err).Should(MatchError(ErrTeamNotFound))
+			Ω(fake.Requests(atc.ListTeams)).Should(Equal(0))
+		})
+	})
+
+	Context("when the job does not exist", func() {
+		It("returns ErrJobNotFound", func() {
+			snapshot, err := takeSnapshot(client, teamName, pipelineName, "does-not-exist", buildName)
+			Ω(err).Should(MatchError(ErrJobNotFound))
+			Ω(snapshot).Should(BeNil())
+		})
+	})
+
+	Context("when the build does not exist", func() {
+		It("returns ErrBuildNotFound", func() {
+			snapshot, err := takeSnapshot(client, teamName, pipelineName, jobName, "does-not-exist")
+			Ω(err).Should(MatchError(ErrBuildNotFound))
+			Ω(snapshot).Should(BeNil())
+		})
+	})
+
+	Context("when the bearer token is rejected", func() {
+		BeforeEach(func() {
+			fakeTeam := new(concoursefakes.FakeTeam)
+			fakeTeam.JobBuildReturns(atc.Build{}, false, concourse.ErrUnauthorized)
+			client.TeamReturns(fakeTeam)
+		})
+
+		It("returns ErrUnauthorized wrapping the cause", func() {
+			snapshot, err := takeSnapshot(client, teamName, pipelineName, jobName, buildName)
+			Ω(err).Should(MatchError(ErrUnauthorized))
+			Ω(errors.Is(err, concourse.ErrUnauthorized)).Should(BeTrue())
+			Ω(snapshot).Should(BeNil())
+		})
+	})
+
+	Context("when the bearer token has no access to the team", func() {
+		BeforeEach(func() {
+			fakeTeam := new(concoursefakes.FakeTeam)
+			fakeTeam.JobBuildReturns(atc.Build{}, false, concourse.ErrForbidden)
+			client.TeamReturns(fakeTeam)
+		})
+
+		It("returns ErrForbidden", func() {
+			snapshot, err := takeSnapshot(client, teamName, pipelineName, jobName, buildName)
+			Ω(err).Should(MatchError(ErrForbidden))
+			Ω(snapshot).Should(BeNil())
+		})
+	})
+
+	Context("getting the pipeline config", func() {
+		It("returns the config", func() {
+			config, err := NewSnapshotter(WithClient(client)).PipelineConfig(teamName, atc.PipelineRef{Name: pipelineName})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(config.Resources).Should(ConsistOf(atc.ResourceConfig{Name: "version", Type: "semver"}))
+		})
+
+		It("returns ErrPipelineNotFound for a missing pipeline", func() {
+			_, err := NewSnapshotter(WithClient(client)).PipelineConfig(teamName, atc.PipelineRef{Name: "missing"})
+			Ω(err).Should(MatchError(ErrPipelineNotFound))
+		})
+	})
+
+	Context("checking for disabled versions", func() {
+		It("reports versions disabled since the build ran", func() {
+			fake := fakeatc.New()
+			defer fake.Close()
+			fake.AddBuild(atc.Build{TeamName: "main", PipelineName: "promote", JobName: "snapshot", Name: "1", Status: atc.StatusSucceeded}, atc.BuildInputsOutputs{
+				Inputs: []atc.PublicBuildInput{
+					{Name: "repo", Version: atc.Version{"ref": "abc"}},
+					{Name: "image", Version: atc.Version{"digest": "sha256:123"}},
+				},
+			})
+			fake.DisableVersion("main", "promote", "image", atc.Version{"digest": "sha256:123"})
+
+			snapshotter := NewSnapshotter(WithClient(fake.Client()))
+			snapshot, err := snapshotter.Snapshot(BuildRef{Team: "main", Pipeline: atc.PipelineRef{Name: "promote"}, Job: "snapshot", Build: "1"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			disabled, _, err := snapshotter.DisabledVersions(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(disabled).Should(HaveLen(1))
+			Ω(disabled[0].Name).Should(Equal("image"))
+		})
+	})
+
+	It("is complete only when recording resource types and task images unfiltered", func() {
+		Ω(NewSnapshotter(WithResourceTypes(), WithTaskImages()).Complete()).Should(BeTrue())
+		Ω(NewSnapshotter(WithResourceTypes()).Complete()).Should(BeFalse())
+		Ω(NewSnapshotter(WithTaskImages()).Complete()).Should(BeFalse())
+		Ω(NewSnapshotter(WithResourceTypes(), WithTaskImages(), WithFilter(Exclude("*-ops"))).Complete()).Should(BeFalse())
+	})
+
+	Context("getting the build plan", func() {
+		It("returns the plan", func() {
+			raw := json.RawMessage(`{"id":"1"}`)
+			client.BuildPlanReturns(atc.PublicBuildPlan{Schema: "exec.v2", Plan: &raw}, true, nil)
+
+			plan, err := NewSnapshotter(WithClient(client)).BuildPlan(2098)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(plan.Schema).Should(Equal("exec.v2"))
+			Ω(client.BuildPlanArgsForCall(0)).Should(Equal(2098))
+		})
+
+		It("returns ErrBuildNotFound for a missing build", func() {
+			_, err := NewSnapshotter(WithClient(client)).BuildPlan(1)
+			Ω(err).Should(MatchError(ErrBuildNotFound))
+		})
+	})
+
+	Context("when getting the build resources fails", func() {
+		var cause = errors.New("connection reset by peer")
+
+		BeforeEach(func() {
+			client.BuildResourcesReturns(atc.BuildInputsOutputs{}, false, cause)
+		})
+
+		It("returns ErrTransport wrapping the cause", func() {
+			snapshot, err := takeSnapshot(client, teamName, pipelineName, jobName, buildName)
+			Ω(err).Should(MatchError(ErrTransport))
+			Ω(errors.Is(err, cause)).Should(BeTrue())
+			Ω(err.Error()).Should(ContainSubstring("connection reset by peer"))
+			Ω(snapshot).Should(BeNil())
+		})
+	})
+})
+
+func rawPlan(plan string) *json.RawMessage {
+	raw := json.RawMessage(plan)
+	return &raw
+}
+
+func takeSnapshot(client concourse.Client, team, pipeline, job, build string) (*Snapshot, error) {
+	return NewSnapshotter(WithClient(client)).Snapshot(BuildRef{
+		Team:     team,
+		Pipeline: atc.PipelineRef{Name: pipeline},
+		Job:      job,
+		Build:    build,
+	})
+}
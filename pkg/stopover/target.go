@@ -0,0 +1,425 @@
+package stopover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/concourse/concourse/atc"
+	"github.com/concourse/concourse/atc/event"
+	"github.com/concourse/concourse/go-concourse/concourse"
+)
+
+// Target is a pipeline that snapshots are applied to, which may be on a
+// different ATC from the one they were taken from.
+type Target struct {
+	client       concourse.Client
+	team         string
+	pipeline     atc.PipelineRef
+	pollInterval time.Duration
+}
+
+// TargetOption configures a Target.
+type TargetOption func(*Target)
+
+// WithPollInterval sets how often builds started by a Target are polled
+// while waiting for them to finish.
+func WithPollInterval(interval time.Duration) TargetOption {
+	return func(t *Target) {
+		t.pollInterval = interval
+	}
+}
+
+// NewTarget returns a Target for a team's pipeline on the ATC client talks
+// to.
+func NewTarget(client concourse.Client, team string, pipeline atc.PipelineRef, opts ...TargetOption) *Target {
+	t := &Target{
+		client:       client,
+		team:         team,
+		pipeline:     pipeline,
+		pollInterval: 2 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
+}
+
+// FindVersion looks up a version of a resource, which must match exactly
+// rather than merely contain the given fields.
+func (t *Target) FindVersion(resource string, version atc.Version) (atc.ResourceVersion, bool, error) {
+	team := t.client.Team(t.team)
+
+	page := &concourse.Page{Limit: 100}
+	for page != nil {
+		versions, pagination, found, err := team.ResourceVersions(t.pipeline, resource, *page, version)
+		if err != nil {
+			return atc.ResourceVersion{}, false, wrapClientErr("listing versions of resource "+resource, err)
+		}
+
+		if !found {
+			return atc.ResourceVersion{}, false, notFound(ErrResourceNotFound, fmt.Sprintf("resource %q not found in pipeline %q", resource, t.pipeline.String()))
+		}
+
+		for _, v := range versions {
+			if equalVersions(v.Version, version) {
+				return v, true, nil
+			}
+		}
+
+		page = pagination.Next
+	}
+
+	return atc.ResourceVersion{}, false, nil
+}
+
+// DisabledVersions resolves each entry in snapshot to its version in the
+// target pipeline and returns the entries whose versions have been disabled.
+// Inputs and outputs named after an aliased get or put step, as with
+// WithStepNames, are resolved to their resources through the config of the
+// job the snapshot was taken from. Entries whose resources the pipeline still
+// does not know are returned as unknown, so that callers can warn that they
+// were not checked. Resource types and task images are skipped, as their
+// versions cannot be disabled.
+func (t *Target) DisabledVersions(snapshot *Snapshot) (disabled, unknown []Entry, err error) {
+	var steps map[Kind]map[string]string
+	for _, entry := range snapshot.Entries {
+		if entry.Kind == KindResourceType || entry.Kind == KindTaskImage {
+			continue
+		}
+
+		version, found, err := t.FindVersion(entry.Name, entry.Version)
+		if errors.Is(err, ErrResourceNotFound) {
+			if steps == nil {
+				steps, err = t.stepResources(snapshot.Source.Job)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+
+			resource, aliased := steps[entry.Kind][entry.Name]
+			if !aliased || resource == entry.Name {
+				unknown = append(unknown, entry)
+				continue
+			}
+
+			version, found, err = t.FindVersion(resource, entry.Version)
+			if errors.Is(err, ErrResourceNotFound) {
+				unknown = append(unknown, entry)
+				continue
+			}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if found && !version.Enabled {
+			disabled = append(disabled, entry)
+		}
+	}
+
+	return disabled, unknown, nil
+}
+
+// stepResources maps the names of the get and put steps of a job in the
+// target pipeline to the resources they use, keyed by the Kind of entry each
+// step produces. The maps are empty if the pipeline or job cannot be found.
+func (t *Target) stepResources(job string) (map[Kind]map[string]string, error) {
+	steps := map[Kind]map[string]string{KindInput: {}, KindOutput: {}}
+	if job == "" {
+		return steps, nil
+	}
+
+	config, _, _, err := t.client.Team(t.team).PipelineConfig(t.pipeline)
+	if err != nil {
+		return nil, wrapClientErr("getting pipeline config", err)
+	}
+
+	jobConfig, found := config.Jobs.Lookup(job)
+	if !found {
+		return steps, nil
+	}
+
+	for _, input := range jobConfig.Inputs() {
+		steps[KindInput][input.Name] = input.Resource
+	}
+
+	for _, output := range jobConfig.Outputs() {
+		steps[KindOutput][output.Name] = output.Resource
+	}
+
+	return steps, nil
+}
+
+// EnsureResult records how a snapshot entry was found on a Target.
+type EnsureResult struct {
+	Entry           Entry
+	ResourceVersion atc.ResourceVersion
+	// CheckBuild is the check that discovered the version, if it was not
+	// already known.
+	CheckBuild *atc.Build
+}
+
+// EnsureVersions makes sure every input version in snapshot is known to the
+// target pipeline, so that it can be pinned. Missing versions are checked
+// from, waiting for each check to finish.
+func (t *Target) EnsureVersions(ctx context.Context, snapshot *Snapshot) ([]EnsureResult, error) {
+	var results []EnsureResult
+	for _, entry := range snapshot.Entries {
+		if entry.Kind != KindInput {
+			continue
+		}
+
+		result, err := t.ensureVersion(ctx, entry)
+		if err != nil {
+			return results, err
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (t *Target) ensureVersion(ctx context.Context, entry Entry) (EnsureResult, error) {
+	result := EnsureResult{Entry: entry}
+
+	version, found, err := t.FindVersion(entry.Name, entry.Version)
+	if err != nil {
+		return result, err
+	}
+
+	if found {
+		result.ResourceVersion = version
+		return result, nil
+	}
+
+	check, found, err := t.client.Team(t.team).CheckResource(t.pipeline, entry.Name, entry.Version)
+	if err != nil {
+		return result, wrapClientErr("checking resource "+entry.Name, err)
+	}
+
+	if !found {
+		return result, notFound(ErrResourceNotFound, fmt.Sprintf("resource %q not found in pipeline %q", entry.Name, t.pipeline.String()))
+	}
+
+	check, err = t.WaitForBuild(ctx, check)
+	result.CheckBuild = &check
+	if err != nil {
+		return result, err
+	}
+
+	if check.Status != atc.StatusSucceeded {
+		return result, fmt.Errorf("check of resource %q for version %s %s", entry.Name, formatVersion(entry.Version), check.Status)
+	}
+
+	version, found, err = t.FindVersion(entry.Name, entry.Version)
+	if err != nil {
+		return result, err
+	}
+
+	if !found {
+		return result, fmt.Errorf("version %s of resource %q not found after checking", formatVersion(entry.Version), entry.Name)
+	}
+
+	result.ResourceVersion = version
+	return result, nil
+}
+
+// WaitForBuild polls a build until it finishes or ctx is done, returning
+// its final state.
+func (t *Target) WaitForBuild(ctx context.Context, build atc.Build) (atc.Build, error) {
+	return t.poll(ctx, build, atc.Build.IsRunning)
+}
+
+// WaitForStart polls a build until it is no longer pending, by which point
+// its inputs have been chosen.
+func (t *Target) WaitForStart(ctx context.Context, build atc.Build) (atc.Build, error) {
+	return t.poll(ctx, build, func(build atc.Build) bool {
+		return build.Status == atc.StatusPending
+	})
+}
+
+func (t *Target) poll(ctx context.Context, build atc.Build, waiting func(atc.Build) bool) (atc.Build, error) {
+	for waiting(build) {
+		select {
+		case <-ctx.Done():
+			return build, ctx.Err()
+		case <-time.After(t.pollInterval):
+		}
+
+		latest, found, err := t.client.Build(strconv.Itoa(build.ID))
+		if err != nil {
+			return build, wrapClientErr("getting build with global ID "+strconv.Itoa(build.ID), err)
+		}
+
+		if !found {
+			return build, notFound(ErrBuildNotFound, "build with global ID "+strconv.Itoa(build.ID)+" not found")
+		}
+
+		build = latest
+	}
+
+	return build, nil
+}
+
+// PinResult records the version a resource was pinned to.
+type PinResult struct {
+	Entry           Entry
+	ResourceVersion atc.ResourceVersion
+}
+
+// Pin pins each of the target pipeline's resources to the input version in
+// snapshot. Every version must already be known to the pipeline; see
+// EnsureVersions. Resource types and task images are left alone, as the ATC
+// cannot pin them.
+func (t *Target) Pin(snapshot *Snapshot) ([]PinResult, error) {
+	var pinned []PinResult
+	for _, entry := range snapshot.Entries {
+		if entry.Kind != KindInput {
+			continue
+		}
+
+		version, found, err := t.FindVersion(entry.Name, entry.Version)
+		if err != nil {
+			return pinned, err
+		}
+
+		if !found {
+			return pinned, fmt.Errorf("version %s of resource %q not found in pipeline %q", formatVersion(entry.Version), entry.Name, t.pipeline.String())
+		}
+
+		found, err = t.client.Team(t.team).PinResourceVersion(t.pipeline, entry.Name, version.ID)
+		if err != nil {
+			return pinned, wrapClientErr("pinning resource "+entry.Name, err)
+		}
+
+		if !found {
+			return pinned, notFound(ErrResourceNotFound, fmt.Sprintf("resource %q not found in pipeline %q", entry.Name, t.pipeline.String()))
+		}
+
+		pinned = append(pinned, PinResult{Entry: entry, ResourceVersion: version})
+	}
+
+	return pinned, nil
+}
+
+// Trigger starts a build of a job in the target pipeline.
+func (t *Target) Trigger(job string) (atc.Build, error) {
+	build, err := t.client.Team(t.team).CreateJobBuild(t.pipeline, job)
+	if err != nil {
+		return atc.Build{}, wrapClientErr("triggering job "+job, err)
+	}
+
+	return build, nil
+}
+
+// VerifyInputs checks that a build used the snapshot's version of every
+// input it shares with the snapshot, returning an error matching
+// ErrInputMismatch if not. Inputs are matched by the resource their get step
+// fetches, falling back to the step name for snapshots taken with
+// WithStepNames. The build must have started.
+func (t *Target) VerifyInputs(build atc.Build, snapshot *Snapshot) error {
+	resources, found, err := t.client.BuildResources(build.ID)
+	if err != nil {
+		return wrapClientErr("getting resources for build with global ID "+strconv.Itoa(build.ID), err)
+	}
+
+	if !found {
+		return notFound(ErrBuildNotFound, "could not get resources for build with global ID "+strconv.Itoa(build.ID))
+	}
+
+	plan, found, err := t.client.BuildPlan(build.ID)
+	if err != nil {
+		return wrapClientErr("getting plan for build with global ID "+strconv.Itoa(build.ID), err)
+	}
+
+	if !found {
+		return notFound(ErrBuildNotFound, "could not get plan for build with global ID "+strconv.Itoa(build.ID))
+	}
+
+	steps, err := StepResources(plan)
+	if err != nil {
+		return err
+	}
+
+	var mismatches []string
+	for _, input := range resources.Inputs {
+		resource := input.Name
+		if name, ok := steps[input.Name]; ok {
+			resource = name
+		}
+
+		entry, found := snapshot.Lookup(KindInput.Prefix() + resource)
+		if !found {
+			entry, found = snapshot.Lookup(KindInput.Prefix() + input.Name)
+		}
+
+		if found && !equalVersions(entry.Version, input.Version) {
+			mismatches = append(mismatches, fmt.Sprintf("%s used %s, not %s", input.Name, formatVersion(input.Version), formatVersion(entry.Version)))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return &Error{
+			Kind:   ErrInputMismatch,
+			Detail: fmt.Sprintf("%s build %s did not use the snapshot's versions: %s", build.JobName, build.Name, strings.Join(mismatches, "; ")),
+		}
+	}
+
+	return nil
+}
+
+// StreamLogs writes a build's logs to w until it finishes.
+func (t *Target) StreamLogs(build atc.Build, w io.Writer) error {
+	events, err := t.client.BuildEvents(strconv.Itoa(build.ID))
+	if err != nil {
+		return wrapClientErr("streaming events for build with global ID "+strconv.Itoa(build.ID), err)
+	}
+	defer events.Close()
+
+	for {
+		ev, err := events.NextEvent()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return wrapClientErr("streaming events for build with global ID "+strconv.Itoa(build.ID), err)
+		}
+
+		switch e := ev.(type) {
+		case event.Log:
+			io.WriteString(w, e.Payload)
+		case event.Error:
+			fmt.Fprintln(w, e.Message)
+		case event.Status:
+			if !(atc.Build{Status: e.Status}).IsRunning() {
+				return nil
+			}
+		}
+	}
+}
+
+// BuildResult returns nil for a succeeded build, or an error matching
+// ErrBuildFailed, ErrBuildErrored or ErrBuildAborted.
+func BuildResult(build atc.Build) error {
+	var kind error
+	switch build.Status {
+	case atc.StatusSucceeded:
+		return nil
+	case atc.StatusFailed:
+		kind = ErrBuildFailed
+	case atc.StatusAborted:
+		kind = ErrBuildAborted
+	default:
+		kind = ErrBuildErrored
+	}
+
+	return &Error{Kind: kind, Detail: fmt.Sprintf("%s build %s %s", build.JobName, build.Name, build.Status)}
+}
@@ -0,0 +1,289 @@
+package stopover_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/stopover"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/concourse/concourse/atc"
+	"github.com/concourse/concourse/atc/event"
+	"github.com/concourse/concourse/go-concourse/concourse"
+	"github.com/concourse/concourse/go-concourse/concourse/concoursefakes"
+)
+
+type fakeEvents struct {
+	events []atc.Event
+}
+
+func (f *fakeEvents) NextEvent() (atc.Event, error) {
+	if len(f.events) == 0 {
+		return nil, io.EOF
+	}
+
+	next := f.events[0]
+	f.events = f.events[1:]
+	return next, nil
+}
+
+func (f *fakeEvents) Close() error {
+	return nil
+}
+
+var _ = Describe("Target", func() {
+	var client *concoursefakes.FakeClient
+	var team *concoursefakes.FakeTeam
+	var target *Target
+	var known []atc.ResourceVersion
+	var checkStatus atc.BuildStatus
+	var snapshot *Snapshot
+
+	BeforeEach(func() {
+		known = []atc.ResourceVersion{
+			{ID: 1, Version: atc.Version{"ref": "aaa", "branch": "main"}, Enabled: true},
+			{ID: 2, Version: atc.Version{"ref": "aaa"}, Enabled: true},
+		}
+		checkStatus = atc.StatusSucceeded
+
+		team = new(concoursefakes.FakeTeam)
+		team.ResourceVersionsStub = func(pipeline atc.PipelineRef, resource string, page concourse.Page, filter atc.Version) ([]atc.ResourceVersion, concourse.Pagination, bool, error) {
+			if resource != "repo" {
+				return nil, concourse.Pagination{}, false, nil
+			}
+
+			var matching []atc.ResourceVersion
+			for _, v := range known {
+				contains := true
+				for field, value := range filter {
+					if v.Version[field] != value {
+						contains = false
+					}
+				}
+				if contains {
+					matching = append(matching, v)
+				}
+			}
+			return matching, concourse.Pagination{}, true, nil
+		}
+		team.CheckResourceStub = func(pipeline atc.PipelineRef, resource string, version atc.Version) (atc.Build, bool, error) {
+			return atc.Build{ID: 99, Status: atc.StatusStarted}, resource == "repo", nil
+		}
+
+		client = new(concoursefakes.FakeClient)
+		client.TeamReturns(team)
+		client.BuildStub = func(id string) (atc.Build, bool, error) {
+			if checkStatus == atc.StatusSucceeded {
+				known = append(known, atc.ResourceVersion{ID: 3, Version: atc.Version{"ref": "bbb"}})
+			}
+			return atc.Build{ID: 99, Status: checkStatus}, true, nil
+		}
+
+		target = NewTarget(client, "main", atc.PipelineRef{Name: "prod"}, WithPollInterval(time.Millisecond))
+		snapshot = &Snapshot{Entries: []Entry{
+			{Key: "resource_version_repo", Kind: KindInput, Name: "repo", Version: atc.Version{"ref": "aaa"}},
+			{Key: "output_version_repo", Kind: KindOutput, Name: "repo", Version: atc.Version{"ref": "zzz"}},
+		}}
+	})
+
+	It("finds versions by exact match", func() {
+		version, found, err := target.FindVersion("repo", atc.Version{"ref": "aaa"})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(found).Should(BeTrue())
+		Ω(version.ID).Should(Equal(2))
+	})
+
+	It("reports disabled versions", func() {
+		known[1].Enabled = false
+		snapshot.Entries = append(snapshot.Entries,
+			Entry{Key: "resource_version_other", Kind: KindInput, Name: "other", Version: atc.Version{"ref": "aaa"}},
+			Entry{Key: "resource_type_version_repo", Kind: KindResourceType, Name: "repo", Version: atc.Version{"ref": "aaa"}},
+		)
+
+		disabled, unknown, err := target.DisabledVersions(snapshot)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(disabled).Should(HaveLen(1))
+		Ω(disabled[0].Key).Should(Equal("resource_version_repo"))
+		Ω(unknown).Should(HaveLen(1))
+		Ω(unknown[0].Key).Should(Equal("resource_version_other"))
+
+		err = DisabledError(disabled)
+		Ω(err).Should(MatchError("snapshot contains disabled versions: resource_version_repo {ref: aaa}"))
+		Ω(errors.Is(err, ErrDisabledVersion)).Should(BeTrue())
+		Ω(DisabledError(nil)).Should(BeNil())
+	})
+
+	It("leaves versions that already exist alone", func() {
+		results, err := target.EnsureVersions(context.Background(), snapshot)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(results).Should(HaveLen(1))
+		Ω(results[0].ResourceVersion.ID).Should(Equal(2))
+		Ω(results[0].CheckBuild).Should(BeNil())
+		Ω(team.CheckResourceCallCount()).Should(Equal(0))
+	})
+
+	It("checks for missing versions and waits for the check", func() {
+		snapshot.Entries[0].Version = atc.Version{"ref": "bbb"}
+
+		results, err := target.EnsureVersions(context.Background(), snapshot)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(results[0].ResourceVersion.ID).Should(Equal(3))
+		Ω(results[0].CheckBuild.Status).Should(Equal(atc.StatusSucceeded))
+
+		_, resource, from := team.CheckResourceArgsForCall(0)
+		Ω(resource).Should(Equal("repo"))
+		Ω(from).Should(Equal(atc.Version{"ref": "bbb"}))
+	})
+
+	It("fails when the check fails", func() {
+		snapshot.Entries[0].Version = atc.Version{"ref": "bbb"}
+		checkStatus = atc.StatusErrored
+
+		_, err := target.EnsureVersions(context.Background(), snapshot)
+		Ω(err).Should(MatchError(`check of resource "repo" for version {ref: bbb} errored`))
+	})
+
+	It("fails when the check does not find the version", func() {
+		snapshot.Entries[0].Version = atc.Version{"ref": "ccc"}
+
+		_, err := target.EnsureVersions(context.Background(), snapshot)
+		Ω(err).Should(MatchError(`version {ref: ccc} of resource "repo" not found after checking`))
+	})
+
+	It("stops waiting when the context is done", func() {
+		snapshot.Entries[0].Version = atc.Version{"ref": "bbb"}
+		checkStatus = atc.StatusStarted
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, err := target.EnsureVersions(ctx, snapshot)
+		Ω(err).Should(MatchError(context.DeadlineExceeded))
+	})
+
+	It("fails for resources missing from the pipeline", func() {
+		snapshot.Entries[0].Name = "missing"
+
+		_, err := target.EnsureVersions(context.Background(), snapshot)
+		Ω(err).Should(MatchError(`resource "missing" not found in pipeline "prod"`))
+		Ω(errors.Is(err, ErrResourceNotFound)).Should(BeTrue())
+	})
+
+	Describe("applying", func() {
+		It("pins each input to the snapshot version", func() {
+			team.PinResourceVersionReturns(true, nil)
+			pinned, err := target.Pin(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pinned).Should(HaveLen(1))
+			Ω(pinned[0].Entry.Name).Should(Equal("repo"))
+			Ω(pinned[0].ResourceVersion.ID).Should(Equal(2))
+
+			_, resource, id := team.PinResourceVersionArgsForCall(0)
+			Ω(resource).Should(Equal("repo"))
+			Ω(id).Should(Equal(2))
+		})
+
+		It("refuses to pin versions the pipeline does not know", func() {
+			snapshot.Entries[0].Version = atc.Version{"ref": "bbb"}
+
+			_, err := target.Pin(snapshot)
+			Ω(err).Should(MatchError(ContainSubstring("version {ref: bbb} of resource \"repo\" not found")))
+			Ω(team.PinResourceVersionCallCount()).Should(Equal(0))
+		})
+
+		It("triggers jobs", func() {
+			team.CreateJobBuildReturns(atc.Build{ID: 7, Name: "3", JobName: "deploy", Status: atc.StatusPending}, nil)
+
+			build, err := target.Trigger("deploy")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(build.ID).Should(Equal(7))
+
+			_, job := team.CreateJobBuildArgsForCall(0)
+			Ω(job).Should(Equal("deploy"))
+		})
+
+		It("verifies a build used the snapshot's versions", func() {
+			build := atc.Build{ID: 7, Name: "3", JobName: "deploy"}
+			client.BuildPlanReturns(atc.PublicBuildPlan{Plan: rawPlan(`{"do":[
+				{"get":{"name":"repo","resource":"repo"}},
+				{"get":{"name":"other","resource":"other"}}
+			]}`)}, true, nil)
+			client.BuildResourcesReturns(atc.BuildInputsOutputs{Inputs: []atc.PublicBuildInput{
+				{Name: "repo", Version: atc.Version{"ref": "aaa"}},
+				{Name: "other", Version: atc.Version{"ref": "zzz"}},
+			}}, true, nil)
+			Ω(target.VerifyInputs(build, snapshot)).Should(Succeed())
+
+			client.BuildResourcesReturns(atc.BuildInputsOutputs{Inputs: []atc.PublicBuildInput{
+				{Name: "repo", Version: atc.Version{"ref": "bbb"}},
+			}}, true, nil)
+			err := target.VerifyInputs(build, snapshot)
+			Ω(err).Should(MatchError(ErrInputMismatch))
+			Ω(err.Error()).Should(Equal("deploy build 3 did not use the snapshot's versions: repo used {ref: bbb}, not {ref: aaa}"))
+		})
+
+		It("matches aliased inputs to the resources they fetch", func() {
+			build := atc.Build{ID: 7, Name: "3", JobName: "deploy"}
+			client.BuildPlanReturns(atc.PublicBuildPlan{Plan: rawPlan(`{"do":[
+				{"get":{"name":"src","resource":"repo"}}
+			]}`)}, true, nil)
+			client.BuildResourcesReturns(atc.BuildInputsOutputs{Inputs: []atc.PublicBuildInput{
+				{Name: "src", Version: atc.Version{"ref": "bbb"}},
+			}}, true, nil)
+
+			err := target.VerifyInputs(build, snapshot)
+			Ω(err).Should(MatchError(ErrInputMismatch))
+			Ω(err.Error()).Should(Equal("deploy build 3 did not use the snapshot's versions: src used {ref: bbb}, not {ref: aaa}"))
+
+			client.BuildResourcesReturns(atc.BuildInputsOutputs{Inputs: []atc.PublicBuildInput{
+				{Name: "src", Version: atc.Version{"ref": "aaa"}},
+			}}, true, nil)
+			Ω(target.VerifyInputs(build, snapshot)).Should(Succeed())
+		})
+
+		It("fails when the build's plan cannot be found", func() {
+			client.BuildResourcesReturns(atc.BuildInputsOutputs{}, true, nil)
+
+			err := target.VerifyInputs(atc.Build{ID: 7}, snapshot)
+			Ω(errors.Is(err, ErrBuildNotFound)).Should(BeTrue())
+		})
+
+		It("waits for builds to start", func() {
+			statuses := []atc.BuildStatus{atc.StatusPending, atc.StatusStarted}
+			client.BuildStub = func(id string) (atc.Build, bool, error) {
+				status := statuses[0]
+				statuses = statuses[1:]
+				return atc.Build{ID: 7, Status: status}, true, nil
+			}
+
+			build, err := target.WaitForStart(context.Background(), atc.Build{ID: 7, Status: atc.StatusPending})
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(build.Status).Should(Equal(atc.StatusStarted))
+			Ω(client.BuildCallCount()).Should(Equal(2))
+		})
+
+		It("streams build logs until the build finishes", func() {
+			client.BuildEventsReturns(&fakeEvents{events: []atc.Event{
+				event.Log{Payload: "deploying\n"},
+				event.Error{Message: "oops"},
+				event.Status{Status: atc.StatusSucceeded},
+				event.Log{Payload: "never seen\n"},
+			}}, nil)
+
+			var logs strings.Builder
+			Ω(target.StreamLogs(atc.Build{ID: 7}, &logs)).Should(Succeed())
+			Ω(logs.String()).Should(Equal("deploying\noops\n"))
+			Ω(client.BuildEventsArgsForCall(0)).Should(Equal("7"))
+		})
+
+		It("maps build statuses to errors", func() {
+			Ω(BuildResult(atc.Build{Status: atc.StatusSucceeded})).Should(Succeed())
+			Ω(BuildResult(atc.Build{Status: atc.StatusFailed})).Should(MatchError(ErrBuildFailed))
+			Ω(BuildResult(atc.Build{Status: atc.StatusErrored})).Should(MatchError(ErrBuildErrored))
+			Ω(BuildResult(atc.Build{Status: atc.StatusAborted, JobName: "deploy", Name: "3"})).Should(MatchError("deploy build 3 aborted"))
+		})
+	})
+})
@@ -0,0 +1,67 @@
+package stopover
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/concourse/concourse/atc"
+)
+
+// ParseBuildURL splits a build's page in the Concourse web UI into the URL of
+// the ATC and a BuildRef. Job builds look like
+// /teams/TEAM/pipelines/PIPELINE/jobs/JOB/builds/BUILD, with any instance
+// vars in the query string. One-off builds, such as those run by fly execute,
+// look like /builds/ID and are referred to by their global ID.
+func ParseBuildURL(raw string) (string, BuildRef, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", BuildRef{}, fmt.Errorf("error parsing build URL [%v]", err)
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return "", BuildRef{}, fmt.Errorf("build URL %q must include a scheme and host", raw)
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(u.EscapedPath(), "/"), "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return "", BuildRef{}, fmt.Errorf("error parsing build URL [%v]", err)
+		}
+		segments = append(segments, unescaped)
+	}
+
+	atcURL := u.Scheme + "://" + u.Host
+	for i, segment := range segments {
+		rest := segments[i:]
+
+		if segment == "teams" && len(rest) == 8 && rest[2] == "pipelines" && rest[4] == "jobs" && rest[6] == "builds" {
+			instanceVars, err := atc.InstanceVarsFromQueryParams(u.Query())
+			if err != nil {
+				return "", BuildRef{}, fmt.Errorf("error parsing instance vars in build URL [%v]", err)
+			}
+
+			return atcURL, BuildRef{
+				Team:     rest[1],
+				Pipeline: atc.PipelineRef{Name: rest[3], InstanceVars: instanceVars},
+				Job:      rest[5],
+				Build:    rest[7],
+			}, nil
+		}
+
+		if segment == "builds" && len(rest) == 2 {
+			id, err := strconv.Atoi(rest[1])
+			if err != nil || id <= 0 {
+				return "", BuildRef{}, fmt.Errorf("build URL %q does not end in a build ID", raw)
+			}
+
+			return atcURL, BuildRef{ID: id}, nil
+		}
+
+		atcURL += "/" + url.PathEscape(segment)
+	}
+
+	return "", BuildRef{}, fmt.Errorf("build URL %q is not the page of a build", raw)
+}
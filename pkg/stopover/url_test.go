@@ -0,0 +1,52 @@
+package stopover_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/stopover"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/concourse/atc"
+)
+
+var _ = Describe("ParseBuildURL", func() {
+	It("parses job build pages", func() {
+		atcURL, ref, err := ParseBuildURL("https://ci.example.com/teams/main/pipelines/promote/jobs/deploy%20prod/builds/42")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(atcURL).Should(Equal("https://ci.example.com"))
+		Ω(ref).Should(Equal(BuildRef{Team: "main", Pipeline: atc.PipelineRef{Name: "promote"}, Job: "deploy prod", Build: "42"}))
+	})
+
+	It("parses instance vars from the query string", func() {
+		_, ref, err := ParseBuildURL(`https://ci.example.com/teams/main/pipelines/promote/jobs/deploy/builds/42.1?vars.branch=%22feature%22&vars.env.region=%22eu%22`)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(ref.Build).Should(Equal("42.1"))
+		Ω(ref.Pipeline.InstanceVars).Should(Equal(atc.InstanceVars{
+			"branch": "feature",
+			"env":    map[string]interface{}{"region": "eu"},
+		}))
+	})
+
+	It("parses one-off build pages into a global ID", func() {
+		atcURL, ref, err := ParseBuildURL("http://localhost:8080/builds/1234")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(atcURL).Should(Equal("http://localhost:8080"))
+		Ω(ref).Should(Equal(BuildRef{ID: 1234}))
+	})
+
+	It("keeps any path the ATC is served under", func() {
+		atcURL, _, err := ParseBuildURL("https://example.com/concourse/builds/1234")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(atcURL).Should(Equal("https://example.com/concourse"))
+	})
+
+	It("rejects URLs that are not build pages", func() {
+		for _, raw := range []string{
+			"ci.example.com/builds/1",
+			"https://ci.example.com/teams/main/pipelines/promote",
+			"https://ci.example.com/builds/latest",
+		} {
+			_, _, err := ParseBuildURL(raw)
+			Ω(err).Should(HaveOccurred(), raw)
+		}
+	})
+})
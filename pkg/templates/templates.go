@@ -0,0 +1,127 @@
+// Package templates renders snapshots through Go text/templates, so that
+// versions can be written in whatever format a deployment tool reads.
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"gopkg.in/yaml.v2"
+)
+
+// Funcs are the helper functions available to templates, alongside the
+// text/template builtins.
+var Funcs = template.FuncMap{
+	"sort":     sortValues,
+	"toJson":   toJSON,
+	"toYaml":   toYAML,
+	"shortSha": shortSHA,
+	"default":  defaultValue,
+}
+
+// Parse parses a template with the helper functions available.
+func Parse(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(Funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template [%v]", err)
+	}
+
+	return tmpl, nil
+}
+
+// Render executes a template against a snapshot. The template's dot is the
+// snapshot, so .Source holds the build's metadata, .Entries the resource
+// versions in key order and .Versions the versions file as a map.
+func Render(tmpl *template.Template, snapshot *stopover.Snapshot) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, snapshot); err != nil {
+		return nil, fmt.Errorf("error rendering template [%v]", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// sortValues returns the sorted keys of a map, or a sorted copy of a list,
+// formatting each as a string.
+func sortValues(value interface{}) ([]string, error) {
+	v := reflect.ValueOf(value)
+	var sorted []string
+	switch v.Kind() {
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			sorted = append(sorted, fmt.Sprint(key.Interface()))
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			sorted = append(sorted, fmt.Sprint(v.Index(i).Interface()))
+		}
+	default:
+		return nil, fmt.Errorf("sort expects a map or list, not %T", value)
+	}
+
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+func toJSON(value interface{}) (string, error) {
+	out, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
+
+// toYAML omits the trailing newline, so that the output can be indented into
+// a larger document.
+func toYAML(value interface{}) (string, error) {
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// shortSHA shortens a commit SHA or image digest to seven characters,
+// dropping any sha256: prefix.
+func shortSHA(sha string) string {
+	sha = strings.TrimPrefix(sha, "sha256:")
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+
+	return sha
+}
+
+// defaultValue returns value, or fallback when value is missing or empty, for
+// use as {{ .Field | default "fallback" }}.
+func defaultValue(fallback, value interface{}) interface{} {
+	if empty(value) {
+		return fallback
+	}
+
+	return value
+}
+
+func empty(value interface{}) bool {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return true
+	}
+
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
@@ -0,0 +1,86 @@
+package templates_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/templates"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+var _ = Describe("Templates", func() {
+	var snapshot *stopover.Snapshot
+
+	entry := func(kind stopover.Kind, name string, version atc.Version) stopover.Entry {
+		return stopover.Entry{Key: kind.Prefix() + name, Kind: kind, Name: name, Version: version}
+	}
+
+	render := func(text string) string {
+		tmpl, err := Parse("test", text)
+		Ω(err).ShouldNot(HaveOccurred())
+		output, err := Render(tmpl, snapshot)
+		Ω(err).ShouldNot(HaveOccurred())
+		return string(output)
+	}
+
+	BeforeEach(func() {
+		snapshot = &stopover.Snapshot{
+			Source: stopover.Source{
+				URL:      "https://ci.example.com",
+				Team:     "main",
+				Pipeline: "promote",
+				Job:      "deploy",
+				Build:    "42",
+				BuildID:  1234,
+			},
+			Entries: []stopover.Entry{
+				entry(stopover.KindInput, "app", atc.Version{"ref": "fce993c58725102a01d9376714e386f7bb011e2f"}),
+				entry(stopover.KindInput, "image", atc.Version{"digest": "sha256:1d2b3c4d5e6f"}),
+			},
+		}
+	})
+
+	It("renders entries and build metadata", func() {
+		output := render(`# {{ .Source.Pipeline }}/{{ .Source.Job }} #{{ .Source.Build }}
+{{ range .Entries }}{{ .Name }} = "{{ index .Version "ref" | default "none" }}"
+{{ end }}`)
+
+		Ω(output).Should(Equal(`# promote/deploy #42
+app = "fce993c58725102a01d9376714e386f7bb011e2f"
+image = "none"
+`))
+	})
+
+	It("shortens SHAs and digests", func() {
+		output := render(`{{ range .Entries }}{{ range .Version }}{{ shortSha . }} {{ end }}{{ end }}`)
+		Ω(output).Should(Equal("fce993c 1d2b3c4 "))
+	})
+
+	It("sorts map keys and lists", func() {
+		Ω(render(`{{ sort .Versions }}`)).Should(Equal("[resource_version_app resource_version_image]"))
+		Ω(render(`{{ range sort (index .Versions "resource_version_image") }}{{ . }}{{ end }}`)).Should(Equal("digest"))
+	})
+
+	It("marshals values as JSON and YAML", func() {
+		Ω(render(`{{ index .Versions "resource_version_app" | toJson }}`)).Should(Equal(`{"ref":"fce993c58725102a01d9376714e386f7bb011e2f"}`))
+		Ω(render(`{{ index .Versions "resource_version_image" | toYaml }}`)).Should(Equal("digest: sha256:1d2b3c4d5e6f"))
+	})
+
+	It("falls back to defaults for empty values", func() {
+		Ω(render(`{{ .Source.Status | default "unknown" }}`)).Should(Equal("unknown"))
+		Ω(render(`{{ .Source.BuildID | default 0 }}`)).Should(Equal("1234"))
+	})
+
+	It("fails on invalid templates", func() {
+		_, err := Parse("test", "{{ .Source")
+		Ω(err).Should(MatchError(ContainSubstring("error parsing template")))
+	})
+
+	It("fails on errors while rendering", func() {
+		tmpl, err := Parse("test", "{{ sort .Source.Team }}")
+		Ω(err).ShouldNot(HaveOccurred())
+		_, err = Render(tmpl, snapshot)
+		Ω(err).Should(MatchError(ContainSubstring("sort expects a map or list")))
+	})
+})
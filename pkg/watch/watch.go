@@ -0,0 +1,384 @@
+// Package watch polls jobs for new succeeded builds and hands a snapshot of
+// each to a Handler, remembering which builds have been handled so that
+// restarts neither miss nor repeat builds.
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/metrics"
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+	"github.com/concourse/concourse/go-concourse/concourse"
+)
+
+// DefaultInterval is how often jobs are polled.
+const DefaultInterval = 30 * time.Second
+
+// DefaultMaxAttempts is how many times a build's handler is tried before the
+// build is given up on.
+const DefaultMaxAttempts = 5
+
+// Handler is called with the snapshot of each new succeeded build. A build
+// whose handler fails is retried on the next poll, up to MaxAttempts times.
+type Handler func(ctx context.Context, snapshot *stopover.Snapshot) error
+
+// Config configures a Watcher.
+type Config struct {
+	// Jobs are the jobs to watch. Their Build is ignored.
+	Jobs []stopover.BuildRef
+	// Interval defaults to DefaultInterval.
+	Interval time.Duration
+	// StatePath is the file recording, for each job, the newest build seen
+	// and the builds that have yet to be handled.
+	StatePath string
+	Handler   Handler
+	// MaxAttempts is how many times a build's handler is tried before the
+	// build is logged and skipped, so that it stops holding up later builds.
+	// It defaults to DefaultMaxAttempts.
+	MaxAttempts int
+	// Logf reports errors that Run carries on past. It defaults to discarding
+	// them.
+	Logf func(format string, args ...interface{})
+	// Metrics, if set, records each snapshot taken and each failure.
+	Metrics *metrics.Metrics
+	// AllowDisabled hands builds to the Handler even if some of their
+	// versions have been disabled. Otherwise such builds are logged and
+	// skipped, so that they do not hold up later builds of the job.
+	AllowDisabled bool
+}
+
+// Watcher polls jobs for new succeeded builds.
+type Watcher struct {
+	client      concourse.Client
+	snapshotter *stopover.Snapshotter
+	config      Config
+	state       map[string]*jobState
+}
+
+// jobState records the newest build of a job that has been seen, and the
+// builds that were still running or whose handler failed, which are checked
+// again on each poll.
+type jobState struct {
+	Last     int         `json:"last"`
+	Pending  []int       `json:"pending,omitempty"`
+	Failures map[int]int `json:"failures,omitempty"`
+}
+
+// New returns a Watcher listing builds with client and taking snapshots with
+// snapshotter, resuming from the state recorded at config.StatePath if any.
+func New(client concourse.Client, snapshotter *stopover.Snapshotter, config Config) (*Watcher, error) {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultMaxAttempts
+	}
+	if config.Logf == nil {
+		config.Logf = func(string, ...interface{}) {}
+	}
+
+	state := map[string]*jobState{}
+	data, err := ioutil.ReadFile(config.StatePath)
+	if err == nil {
+		if err := parseState(data, state); err != nil {
+			return nil, fmt.Errorf("parsing watch state %s: %s", config.StatePath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &Watcher{client: client, snapshotter: snapshotter, config: config, state: state}, nil
+}
+
+// Run polls every Interval until ctx is done, logging errors rather than
+// stopping on them.
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.Poll(ctx); err != nil {
+			w.config.Logf("%s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll handles every succeeded build of each job that has not been handled
+// yet, oldest first, including builds that were still running when a newer
+// build succeeded. The first time a job is seen only its latest succeeded
+// build is handled, rather than its whole history.
+func (w *Watcher) Poll(ctx context.Context) error {
+	var errs []string
+	for _, job := range w.config.Jobs {
+		if err := w.pollJob(ctx, job); err != nil {
+			errs = append(errs, fmt.Sprintf("%s/%s: %s", job.Pipeline.String(), job.Job, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
+
+func (w *Watcher) pollJob(ctx context.Context, job stopover.BuildRef) error {
+	key := stateKey(job)
+	state, seen := w.state[key]
+	if !seen {
+		state = &jobState{}
+	}
+
+	builds, err := w.newBuilds(job, state.Last, seen)
+	if err != nil {
+		return err
+	}
+
+	pending, err := w.pendingBuilds(state.Pending)
+	if err != nil {
+		return err
+	}
+	builds = append(pending, builds...)
+
+	// Record every build that still needs handling before handling any, so
+	// that a failure part way through leaves the rest pending.
+	state.Pending = nil
+	for _, build := range builds {
+		if build.ID > state.Last {
+			state.Last = build.ID
+		}
+		if !build.IsRunning() && build.Status != atc.StatusSucceeded {
+			continue
+		}
+		state.Pending = append(state.Pending, build.ID)
+	}
+	w.state[key] = state
+	if err := w.saveState(); err != nil {
+		return err
+	}
+
+	for _, build := range builds {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if build.Status != atc.StatusSucceeded {
+			continue
+		}
+
+		err := w.handle(ctx, job, build)
+		if err != nil && !errors.Is(err, stopover.ErrDisabledVersion) {
+			if state.Failures == nil {
+				state.Failures = map[int]int{}
+			}
+			state.Failures[build.ID]++
+			if state.Failures[build.ID] < w.config.MaxAttempts {
+				if saveErr := w.saveState(); saveErr != nil {
+					return saveErr
+				}
+				return fmt.Errorf("build %s: %s", build.Name, err)
+			}
+
+			w.config.Logf("giving up on %s/%s build %s after %d attempts: %s", job.Pipeline.String(), job.Job, build.Name, w.config.MaxAttempts, err)
+		}
+
+		state.Pending = remove(state.Pending, build.ID)
+		delete(state.Failures, build.ID)
+		if err := w.saveState(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handle snapshots a build and hands it to the Handler, skipping builds
+// containing disabled versions unless they are allowed.
+func (w *Watcher) handle(ctx context.Context, job stopover.BuildRef, build atc.Build) error {
+	snapshot, err := w.snapshotter.SnapshotBuild(build)
+	if err == nil {
+		err = w.checkDisabled(snapshot)
+	}
+
+	skip := errors.Is(err, stopover.ErrDisabledVersion)
+	if err == nil {
+		err = w.config.Handler(ctx, snapshot)
+	}
+
+	if err != nil && w.config.Metrics != nil {
+		w.config.Metrics.SnapshotFailed(job.Team, job.Pipeline, job.Job)
+	}
+
+	switch {
+	case skip:
+		w.config.Logf("skipping %s/%s build %s: %s", job.Pipeline.String(), job.Job, build.Name, err)
+	case err == nil && w.config.Metrics != nil:
+		w.config.Metrics.SnapshotSucceeded(snapshot)
+	}
+
+	return err
+}
+
+func (w *Watcher) checkDisabled(snapshot *stopover.Snapshot) error {
+	if w.config.AllowDisabled {
+		return nil
+	}
+
+	disabled, unknown, err := w.snapshotter.DisabledVersions(snapshot)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range unknown {
+		w.config.Logf("not checking whether %s is disabled: resource %q not found in pipeline %q", entry.Key, entry.Name, snapshot.Source.PipelineRef().String())
+	}
+
+	return stopover.DisabledError(disabled)
+}
+
+// newBuilds pages back through the job's builds, newest first, until
+// reaching the newest build already seen, returning the newer ones oldest
+// first. The first time a job is seen, builds older than its latest succeeded
+// build are left out.
+func (w *Watcher) newBuilds(job stopover.BuildRef, last int, seen bool) ([]atc.Build, error) {
+	team := w.client.Team(job.Team)
+
+	var builds []atc.Build
+	page := &concourse.Page{Limit: 100}
+	for page != nil {
+		listed, pagination, found, err := team.JobBuilds(job.Pipeline, job.Job, *page)
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			return nil, fmt.Errorf("job %q not found in pipeline %q", job.Job, job.Pipeline.String())
+		}
+
+		for _, build := range listed {
+			if seen && build.ID <= last {
+				page = nil
+				break
+			}
+
+			builds = append(builds, build)
+			if !seen && build.Status == atc.StatusSucceeded {
+				page = nil
+				break
+			}
+		}
+
+		if page != nil {
+			page = pagination.Next
+		}
+	}
+
+	sort.Slice(builds, func(i, j int) bool {
+		return builds[i].ID < builds[j].ID
+	})
+
+	return builds, nil
+}
+
+// pendingBuilds fetches the current state of builds left pending by earlier
+// polls. Builds that no longer exist are dropped.
+func (w *Watcher) pendingBuilds(ids []int) ([]atc.Build, error) {
+	var builds []atc.Build
+	for _, id := range ids {
+		build, found, err := w.client.Build(strconv.Itoa(id))
+		if err != nil {
+			return nil, err
+		}
+
+		if found {
+			builds = append(builds, build)
+		}
+	}
+
+	return builds, nil
+}
+
+// saveState writes the state via a temporary file so that a crash never
+// leaves it truncated.
+func (w *Watcher) saveState() error {
+	if w.config.StatePath == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(w.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(w.config.StatePath), ".stopover-watch")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), w.config.StatePath)
+}
+
+// parseState reads a state file, including those written before pending
+// builds were tracked, which recorded just the last build handled.
+func parseState(data []byte, state map[string]*jobState) error {
+	var jobs map[string]*jobState
+	if err := json.Unmarshal(data, &jobs); err == nil {
+		for key, job := range jobs {
+			state[key] = job
+		}
+		return nil
+	}
+
+	var last map[string]int
+	if err := json.Unmarshal(data, &last); err != nil {
+		return err
+	}
+
+	for key, id := range last {
+		state[key] = &jobState{Last: id}
+	}
+
+	return nil
+}
+
+func remove(ids []int, id int) []int {
+	var kept []int
+	for _, i := range ids {
+		if i != id {
+			kept = append(kept, i)
+		}
+	}
+
+	return kept
+}
+
+func stateKey(job stopover.BuildRef) string {
+	return job.Team + "/" + job.Pipeline.String() + "/" + job.Job
+}
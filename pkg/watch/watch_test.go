@@ -0,0 +1,227 @@
+package watch_test
+
+import (
+	. "github.com/EngineerBetter/stopover/pkg/watch"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/EngineerBetter/stopover/pkg/fakeatc"
+	"github.com/EngineerBetter/stopover/pkg/metrics"
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+var _ = Describe("Watcher", func() {
+	var fake *fakeatc.ATC
+	var dir string
+	var handled []string
+	var handlerErr error
+
+	addBuild := func(name string, status atc.BuildStatus) atc.Build {
+		return fake.AddBuild(
+			atc.Build{TeamName: "main", PipelineName: "promote", JobName: "test", Name: name, Status: status},
+			atc.BuildInputsOutputs{Inputs: []atc.PublicBuildInput{{Name: "repo", Version: atc.Version{"ref": name}}}},
+		)
+	}
+
+	newWatcher := func() *Watcher {
+		client := fake.Client()
+		watcher, err := New(client, stopover.NewSnapshotter(stopover.WithClient(client)), Config{
+			Jobs:      []stopover.BuildRef{{Team: "main", Pipeline: atc.PipelineRef{Name: "promote"}, Job: "test"}},
+			StatePath: filepath.Join(dir, "state.json"),
+			Handler: func(ctx context.Context, snapshot *stopover.Snapshot) error {
+				if handlerErr != nil {
+					return handlerErr
+				}
+				handled = append(handled, snapshot.Source.Build+":"+snapshot.Versions()["resource_version_repo"]["ref"])
+				return nil
+			},
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+		return watcher
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "stopover-watch-test")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fake = fakeatc.New()
+		handled = nil
+		handlerErr = nil
+
+		addBuild("1", atc.StatusSucceeded)
+		addBuild("2", atc.StatusSucceeded)
+		addBuild("3", atc.StatusFailed)
+	})
+
+	AfterEach(func() {
+		fake.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("starts from the latest succeeded build", func() {
+		Ω(newWatcher().Poll(context.Background())).Should(Succeed())
+		Ω(handled).Should(Equal([]string{"2:2"}))
+	})
+
+	It("handles each new succeeded build once, oldest first", func() {
+		watcher := newWatcher()
+		Ω(watcher.Poll(context.Background())).Should(Succeed())
+
+		addBuild("4", atc.StatusSucceeded)
+		addBuild("5", atc.StatusErrored)
+		addBuild("6", atc.StatusSucceeded)
+		Ω(watcher.Poll(context.Background())).Should(Succeed())
+		Ω(watcher.Poll(context.Background())).Should(Succeed())
+
+		Ω(handled).Should(Equal([]string{"2:2", "4:4", "6:6"}))
+	})
+
+	It("resumes from the recorded state after a restart", func() {
+		Ω(newWatcher().Poll(context.Background())).Should(Succeed())
+		addBuild("4", atc.StatusSucceeded)
+
+		Ω(newWatcher().Poll(context.Background())).Should(Succeed())
+		Ω(handled).Should(Equal([]string{"2:2", "4:4"}))
+	})
+
+	It("retries builds whose handler failed", func() {
+		watcher := newWatcher()
+		handlerErr = errors.New("webhook down")
+		Ω(watcher.Poll(context.Background())).Should(MatchError(ContainSubstring("webhook down")))
+
+		handlerErr = nil
+		Ω(watcher.Poll(context.Background())).Should(Succeed())
+		Ω(handled).Should(Equal([]string{"2:2"}))
+	})
+
+	It("handles builds that were still running when a newer build succeeded", func() {
+		watcher := newWatcher()
+		Ω(watcher.Poll(context.Background())).Should(Succeed())
+
+		running := addBuild("4", atc.StatusStarted)
+		addBuild("5", atc.StatusSucceeded)
+		Ω(watcher.Poll(context.Background())).Should(Succeed())
+		Ω(handled).Should(Equal([]string{"2:2", "5:5"}))
+
+		fake.SetBuildStatus(running.ID, atc.StatusSucceeded)
+		Ω(newWatcher().Poll(context.Background())).Should(Succeed())
+		Ω(handled).Should(Equal([]string{"2:2", "5:5", "4:4"}))
+	})
+
+	It("gives up on a build once its handler has failed MaxAttempts times", func() {
+		var logged []string
+		client := fake.Client()
+		watcher, err := New(client, stopover.NewSnapshotter(stopover.WithClient(client)), Config{
+			Jobs:        []stopover.BuildRef{{Team: "main", Pipeline: atc.PipelineRef{Name: "promote"}, Job: "test"}},
+			StatePath:   filepath.Join(dir, "state.json"),
+			MaxAttempts: 2,
+			Handler: func(ctx context.Context, snapshot *stopover.Snapshot) error {
+				if snapshot.Source.Build == "4" {
+					return errors.New("webhook rejected build 4")
+				}
+				handled = append(handled, snapshot.Source.Build)
+				return nil
+			},
+			Logf: func(format string, args ...interface{}) {
+				logged = append(logged, fmt.Sprintf(format, args...))
+			},
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(watcher.Poll(context.Background())).Should(Succeed())
+
+		addBuild("4", atc.StatusSucceeded)
+		addBuild("5", atc.StatusSucceeded)
+		Ω(watcher.Poll(context.Background())).Should(MatchError(ContainSubstring("webhook rejected build 4")))
+		Ω(handled).Should(Equal([]string{"2"}))
+
+		Ω(watcher.Poll(context.Background())).Should(Succeed())
+		Ω(handled).Should(Equal([]string{"2", "5"}))
+		Ω(logged).Should(ConsistOf(ContainSubstring("giving up on promote/test build 4 after 2 attempts")))
+	})
+
+	It("reads state files recording only the last build handled", func() {
+		Ω(ioutil.WriteFile(filepath.Join(dir, "state.json"), []byte(`{"main/promote/test": 1}`), 0644)).Should(Succeed())
+
+		Ω(newWatcher().Poll(context.Background())).Should(Succeed())
+		Ω(handled).Should(Equal([]string{"2:2"}))
+	})
+
+	It("skips builds containing disabled versions unless allowed", func() {
+		var logged []string
+		newWatcherAllowing := func(allow bool) *Watcher {
+			client := fake.Client()
+			watcher, err := New(client, stopover.NewSnapshotter(stopover.WithClient(client)), Config{
+				Jobs: []stopover.BuildRef{{Team: "main", Pipeline: atc.PipelineRef{Name: "promote"}, Job: "test"}},
+				Handler: func(ctx context.Context, snapshot *stopover.Snapshot) error {
+					handled = append(handled, snapshot.Source.Build)
+					return nil
+				},
+				Logf: func(format string, args ...interface{}) {
+					logged = append(logged, fmt.Sprintf(format, args...))
+				},
+				AllowDisabled: allow,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+			return watcher
+		}
+
+		watcher := newWatcherAllowing(false)
+		Ω(watcher.Poll(context.Background())).Should(Succeed())
+
+		addBuild("4", atc.StatusSucceeded)
+		addBuild("5", atc.StatusSucceeded)
+		fake.DisableVersion("main", "promote", "repo", atc.Version{"ref": "4"})
+		Ω(watcher.Poll(context.Background())).Should(Succeed())
+		Ω(handled).Should(Equal([]string{"2", "5"}))
+		Ω(logged).Should(ConsistOf(ContainSubstring("skipping promote/test build 4: snapshot contains disabled versions")))
+
+		handled = nil
+		addBuild("6", atc.StatusSucceeded)
+		fake.DisableVersion("main", "promote", "repo", atc.Version{"ref": "6"})
+		Ω(newWatcherAllowing(true).Poll(context.Background())).Should(Succeed())
+		Ω(handled).Should(Equal([]string{"6"}))
+	})
+
+	It("records snapshots and failures in metrics", func() {
+		m := metrics.New()
+		client := fake.Client()
+		watcher, err := New(client, stopover.NewSnapshotter(stopover.WithClient(client)), Config{
+			Jobs:    []stopover.BuildRef{{Team: "main", Pipeline: atc.PipelineRef{Name: "promote"}, Job: "test"}},
+			Handler: func(context.Context, *stopover.Snapshot) error { return handlerErr },
+			Metrics: m,
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		handlerErr = errors.New("webhook down")
+		watcher.Poll(context.Background())
+		handlerErr = nil
+		watcher.Poll(context.Background())
+
+		var scraped strings.Builder
+		m.WriteTo(&scraped)
+		Ω(scraped.String()).Should(ContainSubstring(`stopover_snapshots_total{team="main",pipeline="promote",job="test",result="failure"} 1`))
+		Ω(scraped.String()).Should(ContainSubstring(`stopover_snapshots_total{team="main",pipeline="promote",job="test",result="success"} 1`))
+		Ω(scraped.String()).Should(ContainSubstring(`stopover_snapshot_build_info{team="main",pipeline="promote",job="test",build="2"} 1`))
+	})
+
+	It("reports missing jobs", func() {
+		client := fake.Client()
+		watcher, err := New(client, stopover.NewSnapshotter(stopover.WithClient(client)), Config{
+			Jobs:    []stopover.BuildRef{{Team: "main", Pipeline: atc.PipelineRef{Name: "promote"}, Job: "deploy"}},
+			Handler: func(context.Context, *stopover.Snapshot) error { return nil },
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(watcher.Poll(context.Background())).Should(MatchError(ContainSubstring(`job "deploy" not found`)))
+	})
+})
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/EngineerBetter/stopover/pkg/policy"
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/concourse/concourse/atc"
+)
+
+const checkPolicyUsage = `Usage:
+$ export ATC_BEARER_TOKEN="eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.eyJj....."
+$ stopover check-policy --policy policy.yml [--format text|json] https://ci.server.tld my-team my-pipeline my-job job-build-id
+$ stopover check-policy --policy policy.yml [--format text|json] --versions versions.yml [--url https://ci.server.tld --team my-team --pipeline my-pipeline]
+
+Snapshots a build, or reads a versions file, and checks each resource version
+against the rules in the policy file, printing every violation. Exits non-zero
+if any rule of error severity is violated. The build may be given in any form
+the snapshot command accepts. The pipeline of a versions file defaults to the
+one in its header.`
+
+func checkPolicyCommand(args []string) {
+	flags := flag.NewFlagSet("stopover check-policy", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	var snapshotFlags snapshotFlags
+	snapshotFlags.register(flags)
+	policyPath := flags.String("policy", "", "policy file of rules to check")
+	format := flags.String("format", "text", "output format: text or json")
+	versionsPath := flags.String("versions", "", "check this versions file rather than snapshotting a build")
+	url := flags.String("url", "", "ATC URL, if not the one in the versions file's header")
+	team := flags.String("team", "", "team owning the pipeline, if not the one in the header")
+	pipeline := flags.String("pipeline", "", "pipeline the versions came from, if not the one in the header")
+
+	if err := flags.Parse(args); err != nil || *policyPath == "" || os.Getenv("ATC_BEARER_TOKEN") == "" {
+		printUsageAndExit(flags, checkPolicyUsage, ExitFailure)
+	}
+
+	if *format != "text" && *format != "json" {
+		printUsageAndExit(flags, checkPolicyUsage, ExitFailure)
+	}
+
+	var snapshot *stopover.Snapshot
+	var ref stopover.BuildRef
+	if *versionsPath != "" {
+		if flags.NArg() != 0 {
+			printUsageAndExit(flags, checkPolicyUsage, ExitFailure)
+		}
+
+		var err error
+		snapshot, err = readVersionsFile(*versionsPath)
+		exitIfErr(err)
+
+		if *pipeline != "" {
+			snapshot.Source.Pipeline, snapshot.Source.InstanceVars = *pipeline, nil
+		}
+		if *url != "" {
+			snapshot.Source.URL = *url
+		}
+		if *team != "" {
+			snapshot.Source.Team = *team
+		}
+		if snapshot.Source.URL == "" || snapshot.Source.Team == "" || snapshot.Source.Pipeline == "" {
+			fmt.Fprintln(os.Stderr, "--url, --team and --pipeline are required for versions files without a header")
+			printUsageAndExit(flags, checkPolicyUsage, ExitFailure)
+		}
+		*url = snapshot.Source.URL
+	} else {
+		var err error
+		*url, ref, err = parseBuildArgs(flags.Args())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			printUsageAndExit(flags, checkPolicyUsage, ExitFailure)
+		}
+	}
+
+	data, err := ioutil.ReadFile(*policyPath)
+	exitIfErr(err)
+	rules, err := policy.Parse(data)
+	exitIfErr(err)
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+	client := clientFlags.client(ctx, *url)
+
+	snapshotter := snapshotFlags.snapshotter(client)
+	if snapshot == nil {
+		snapshot, err = snapshotter.Snapshot(ref)
+		exitIfErr(err)
+	}
+
+	// One-off builds have no pipeline to look up types, sources and metadata
+	// in, so only rules about names and versions are meaningful for them.
+	var config atc.Config
+	var target *stopover.Target
+	if snapshot.Source.Pipeline != "" {
+		config, err = snapshotter.PipelineConfig(snapshot.Source.Team, snapshot.Source.PipelineRef())
+		exitIfErr(err)
+		target = stopover.NewTarget(client, snapshot.Source.Team, snapshot.Source.PipelineRef())
+	}
+
+	resources, err := policy.Resources(snapshot, config, target)
+	exitIfErr(err)
+	violations, err := rules.Check(resources)
+	exitIfErr(err)
+
+	if *format == "json" {
+		if violations == nil {
+			violations = []policy.Violation{}
+		}
+		output, err := json.MarshalIndent(violations, "", "  ")
+		exitIfErr(err)
+		fmt.Println(string(output))
+	} else {
+		for _, violation := range violations {
+			fmt.Println(violation)
+		}
+	}
+
+	exitIfErr(policy.Error(violations))
+	fmt.Fprintf(os.Stderr, "checked %d resources against %d rules\n", len(resources), len(rules.Rules))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/EngineerBetter/stopover/pkg/publish"
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+)
+
+// publishFlags holds the flags controlling where snapshots are published.
+type publishFlags struct {
+	target string
+	config publish.Config
+}
+
+func (p *publishFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&p.target, "publish", "", "also publish the versions file to s3://bucket/key, git:<repo>#<branch>:<path>, file:<path> or an http(s) webhook URL")
+	flags.StringVar(&p.config.S3.Endpoint, "s3-endpoint", "", "S3-compatible endpoint, e.g. http://localhost:9000 for MinIO")
+	flags.StringVar(&p.config.S3.Region, "s3-region", "", "S3 region (defaults to $AWS_REGION or us-east-1)")
+	flags.StringVar(&p.config.S3.SSE, "s3-sse", "", "S3 server-side encryption: AES256 or aws:kms")
+	flags.StringVar(&p.config.S3.KMSKeyID, "s3-sse-kms-key-id", "", "KMS key ID for aws:kms server-side encryption")
+}
+
+// publish uploads data if a target was given, reporting where it went on
+// stderr so that stdout remains the versions file.
+func (p *publishFlags) publish(ctx context.Context, snapshot *stopover.Snapshot, data []byte) error {
+	if p.target == "" {
+		return nil
+	}
+
+	publisher, err := publish.New(p.target, p.config)
+	if err != nil {
+		return err
+	}
+
+	location, err := publisher.Publish(ctx, snapshot, data)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "published", location)
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/metrics"
+	"github.com/EngineerBetter/stopover/pkg/server"
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+)
+
+const serveUsage = `Usage:
+$ export ATC_BEARER_TOKEN="eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.eyJj....."
+$ stopover serve --url https://ci.server.tld [--listen :8080] [--allow-disabled]
+
+Serves GET /teams/{team}/pipelines/{pipeline}/jobs/{job}/builds/{build}/versions
+where {build} may be latest-succeeded. Add ?format=json for JSON. Snapshots
+containing disabled versions are refused with 409 unless --allow-disabled.
+Prometheus metrics are served on /metrics.`
+
+func serveCommand(args []string) {
+	flags := flag.NewFlagSet("stopover serve", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	url := flags.String("url", "", "ATC URL")
+	listen := flags.String("listen", ":8080", "address to listen on")
+	cacheSize := flags.Int("cache-size", server.DefaultCacheSize, "number of finished builds' snapshots to cache")
+	allowDisabled := flags.Bool("allow-disabled", false, "serve snapshots containing disabled versions rather than refusing them")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 || *url == "" || os.Getenv("ATC_BEARER_TOKEN") == "" {
+		printUsageAndExit(flags, serveUsage, ExitFailure)
+	}
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+
+	m := metrics.New()
+	clientFlags.config.Metrics = m
+	snapshotter := stopover.NewSnapshotter(stopover.WithClient(clientFlags.client(ctx, *url)))
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	opts := []server.Option{server.WithMetrics(m)}
+	if *allowDisabled {
+		opts = append(opts, server.WithAllowDisabled())
+	}
+	mux.Handle("/", server.New(snapshotter, *cacheSize, opts...))
+	httpServer := &http.Server{
+		Addr:    *listen,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintln(os.Stderr, "serving snapshots on", *listen)
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		exitIfErr(err)
+	}
+}
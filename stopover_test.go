@@ -5,10 +5,12 @@ import (
 	. "github.com/onsi/gomega"
 	. "github.com/onsi/gomega/gbytes"
 
+	"bytes"
 	"encoding/json"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 
 	hoverfly "github.com/SpectoLabs/hoverfly/core"
@@ -108,8 +110,263 @@ var _ = Describe("Stopover", func() {
 		})
 
 		It("outputs a YAML file of resource versions", func() {
-			Eventually(session).Should(Say(expected))
-			Ω(session).Should(gexec.Exit(0))
+			Eventually(session).Should(gexec.Exit(0))
+			Ω(string(session.Out.Contents())).Should(ContainSubstring(expected))
+		})
+
+		Context("when given the build's web URL", func() {
+			BeforeEach(func() {
+				args = []string{"https://ci.engineerbetter.com/teams/main/pipelines/control-tower/jobs/minor/builds/1"}
+			})
+
+			It("outputs the same versions", func() {
+				Eventually(session).Should(gexec.Exit(0))
+				Ω(string(session.Out.Contents())).Should(ContainSubstring(expected))
+			})
+		})
+	})
+
+	Context("when recording history", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "stopover-history")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			args = []string{"--history", filepath.Join(dir, "history.db"), "https://ci.engineerbetter.com", "main", "control-tower", "minor", "1"}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("records the snapshot so it can be queried later", func() {
+			Eventually(session).Should(gexec.Exit(0))
+
+			list, err := gexec.Start(exec.Command(binPath, "history", "list", "--db", filepath.Join(dir, "history.db")), GinkgoWriter, GinkgoWriter)
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(list).Should(gexec.Exit(0))
+			Ω(list.Out).Should(Say(`1\s+\S+\s+main\s+control-tower\s+minor\s+1\s+4`))
+
+			find, err := gexec.Start(exec.Command(binPath, "history", "find-version", "--db", filepath.Join(dir, "history.db"), "--resource", "version", "number=0.2.0"), GinkgoWriter, GinkgoWriter)
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(find).Should(gexec.Exit(0))
+			Ω(find.Out).Should(Say(`1\s+\S+\s+main\s+control-tower`))
+
+			show, err := gexec.Start(exec.Command(binPath, "history", "show", "--db", filepath.Join(dir, "history.db"), "1"), GinkgoWriter, GinkgoWriter)
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(show).Should(gexec.Exit(0))
+			Ω(show.Out).Should(Say("resource_version_version:\n  number: 0.2.0"))
+		})
+
+		It("does not create a store for mistyped history commands", func() {
+			Eventually(session).Should(gexec.Exit(0))
+
+			for _, command := range [][]string{{"lsit"}, {"show", "one"}, {"find-version", "number"}} {
+				command = append([]string{"history", command[0], "--db", filepath.Join(dir, "typo.db")}, command[1:]...)
+				typo, err := gexec.Start(exec.Command(binPath, command...), GinkgoWriter, GinkgoWriter)
+				Ω(err).ShouldNot(HaveOccurred())
+				Eventually(typo).Should(gexec.Exit(1))
+				Ω(filepath.Join(dir, "typo.db")).ShouldNot(BeAnExistingFile())
+			}
+		})
+
+		Context("when publishing fails", func() {
+			BeforeEach(func() {
+				args = append([]string{"--publish", "git:" + filepath.Join(dir, "missing") + "#main:versions.yml"}, args...)
+			})
+
+			It("does not record the snapshot", func() {
+				Eventually(session).Should(gexec.Exit(1))
+				Ω(filepath.Join(dir, "history.db")).ShouldNot(BeAnExistingFile())
+			})
+		})
+	})
+
+	Context("when writing a header", func() {
+		BeforeEach(func() {
+			args = []string{"--header", "https://ci.engineerbetter.com", "main", "control-tower", "minor", "1"}
+		})
+
+		It("heads the versions file with where it came from", func() {
+			Eventually(session).Should(gexec.Exit(0))
+			Ω(session.Out).Should(Say("stopover:\n  schema_version: 1\n  atc: https://ci.engineerbetter.com\n  team: main\n  pipeline: control-tower\n  job: minor\n  build: \"1\"\n  build_id: 327\n"))
+			Ω(session.Out).Should(Say("  stopover_version: dev\nresource_version_control-tower:\n"))
+		})
+
+		It("produces a file that validates", func() {
+			Eventually(session).Should(gexec.Exit(0))
+
+			validate := exec.Command(binPath, "validate", "-")
+			validate.Stdin = bytes.NewReader(session.Out.Contents())
+			validation, err := gexec.Start(validate, GinkgoWriter, GinkgoWriter)
+			Ω(err).ShouldNot(HaveOccurred())
+			Eventually(validation).Should(gexec.Exit(0))
+			Ω(validation.Out).Should(Say("- is a valid versions file"))
+		})
+	})
+
+	Context("when validating an invalid versions file", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "stopover-validate")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(ioutil.WriteFile(filepath.Join(dir, "versions.yml"), []byte("stopover:\n  schema_version: 2\nresource_version_app:\n  ref: abc\n"), 0644)).Should(Succeed())
+
+			args = []string{"validate", filepath.Join(dir, "versions.yml")}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("reports the problems", func() {
+			Eventually(session).Should(gexec.Exit(1))
+			Ω(session.Err).Should(Say("stopover.schema_version: stopover.schema_version must be one of the following: 1"))
+			Ω(session.Err).Should(Say("versions.yml is not a valid versions file"))
+		})
+	})
+
+	Context("when checking a policy", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "stopover-policy")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			policy := `rules:
+- name: trusted-registry
+  description: images must come from registry.example.com
+  when: eq .Type "registry-image"
+  require: hasPrefix "registry.example.com/" .Source.repository
+- name: tagged-commits
+  severity: warning
+  when: eq .Type "git"
+  require: .Source.tag_filter
+`
+			Ω(ioutil.WriteFile(filepath.Join(dir, "policy.yml"), []byte(policy), 0644)).Should(Succeed())
+
+			args = []string{"check-policy", "--policy", filepath.Join(dir, "policy.yml"), "https://ci.engineerbetter.com", "main", "control-tower", "minor", "1"}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("reports violations and fails on errors", func() {
+			Eventually(session).Should(gexec.Exit(15))
+			Ω(string(session.Out.Contents())).Should(Equal("error: trusted-registry: resource_version_pcf-ops: images must come from registry.example.com\n" +
+				"warning: tagged-commits: resource_version_control-tower: does not meet requirement: .Source.tag_filter\n"))
+			Ω(session.Err).Should(Say(`policy violated: 1 error\(s\) and 1 warning\(s\)`))
+		})
+
+		Context("when given a versions file", func() {
+			BeforeEach(func() {
+				expected, err := ioutil.ReadFile("./fixtures/expected_output.yml")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(ioutil.WriteFile(filepath.Join(dir, "versions.yml"), expected, 0644)).Should(Succeed())
+
+				args = []string{"check-policy", "--policy", filepath.Join(dir, "policy.yml"), "--versions", filepath.Join(dir, "versions.yml")}
+			})
+
+			It("requires the pipeline when the file has no header", func() {
+				Eventually(session).Should(gexec.Exit(1))
+				Ω(session.Err).Should(Say("--url, --team and --pipeline are required for versions files without a header"))
+			})
+
+			Context("and the pipeline it came from", func() {
+				BeforeEach(func() {
+					args = append(args, "--url", "https://ci.engineerbetter.com", "--team", "main", "--pipeline", "control-tower")
+				})
+
+				It("checks the versions against that pipeline", func() {
+					Eventually(session).Should(gexec.Exit(15))
+					Ω(string(session.Out.Contents())).Should(Equal("error: trusted-registry: resource_version_pcf-ops: images must come from registry.example.com\n" +
+						"warning: tagged-commits: resource_version_control-tower: does not meet requirement: .Source.tag_filter\n"))
+				})
+			})
+
+			Context("with a header", func() {
+				BeforeEach(func() {
+					expected, err := ioutil.ReadFile("./fixtures/expected_output.yml")
+					Ω(err).ShouldNot(HaveOccurred())
+					header := "stopover:\n  schema_version: 1\n  atc: https://ci.engineerbetter.com\n  team: main\n  pipeline: control-tower\n"
+					Ω(ioutil.WriteFile(filepath.Join(dir, "versions.yml"), append([]byte(header), expected...), 0644)).Should(Succeed())
+				})
+
+				It("checks the versions against the pipeline in the header", func() {
+					Eventually(session).Should(gexec.Exit(15))
+					Ω(session.Out).Should(Say("error: trusted-registry: resource_version_pcf-ops"))
+				})
+			})
+		})
+	})
+
+	Context("when reporting lag", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "stopover-lag")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			expected, err := ioutil.ReadFile("./fixtures/expected_output.yml")
+			Ω(err).ShouldNot(HaveOccurred())
+			header := "stopover:\n  schema_version: 1\n  atc: https://ci.engineerbetter.com\n  team: main\n  pipeline: control-tower\n"
+			Ω(ioutil.WriteFile(filepath.Join(dir, "versions.yml"), append([]byte(header), expected...), 0644)).Should(Succeed())
+
+			args = []string{"lag", "--max-behind", "0", filepath.Join(dir, "versions.yml")}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("compares against the pipeline in the header", func() {
+			Eventually(session).Should(gexec.Exit(0))
+			Ω(session.Out).Should(Say(`KEY\s+BEHIND\s+AGE\s+LATEST\s+STALE\n`))
+			Ω(session.Out).Should(Say(`resource_version_version\s+0\s+-\s+{"number":"0.2.0"}\s*\n`))
+		})
+	})
+
+	Context("when rendering a template", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "stopover-template")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			template := `{{ range .Entries }}{{ if eq .Name "version" }}{{ $.Source.Job }}_version = "{{ .Version.number }}"{{ end }}{{ end }}
+`
+			Ω(ioutil.WriteFile(filepath.Join(dir, "vars.tfvars.tmpl"), []byte(template), 0644)).Should(Succeed())
+
+			args = []string{"--template", filepath.Join(dir, "vars.tfvars.tmpl"), "https://ci.engineerbetter.com", "main", "control-tower", "minor", "1"}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("prints the rendered template", func() {
+			Eventually(session).Should(gexec.Exit(0))
+			Ω(string(session.Out.Contents())).Should(Equal("minor_version = \"0.2.0\"\n"))
+		})
+
+		Context("when combined with --format", func() {
+			BeforeEach(func() {
+				args = append([]string{"--format", "cyclonedx"}, args...)
+			})
+
+			It("refuses", func() {
+				Eventually(session).Should(gexec.Exit(1))
+				Ω(session.Err).Should(Say("--template cannot be combined with --format"))
+			})
 		})
 	})
 
@@ -118,6 +375,56 @@ Usage:
 $ export ATC_BEARER_TOKEN="eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.eyJj....."
 $ stopover https://ci.server.tld my-team my-pipeline my-job job-build-id`)
 
+	Context("when merging versions files", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "stopover-merge")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(ioutil.WriteFile(filepath.Join(dir, "prod.yml"), []byte("resource_version_app:\n  ref: abc\nresource_version_config:\n  ref: def\n"), 0644)).Should(Succeed())
+			Ω(ioutil.WriteFile(filepath.Join(dir, "hotfix.yml"), []byte("resource_version_app:\n  ref: fff\n"), 0644)).Should(Succeed())
+
+			args = []string{"merge", filepath.Join(dir, "prod.yml"), filepath.Join(dir, "hotfix.yml"), "--set", "resource_version_config.ref=123"}
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("prints the merged versions and reports overrides", func() {
+			Eventually(session).Should(gexec.Exit(0))
+			Ω(string(session.Out.Contents())).Should(Equal("resource_version_app:\n  ref: fff\nresource_version_config:\n  ref: \"123\"\n"))
+			Ω(session.Err).Should(Say(`resource_version_app: {ref: abc} -> {ref: fff} \(from .*hotfix.yml\)`))
+			Ω(session.Err).Should(Say(`resource_version_config: {ref: def} -> {ref: 123} \(from --set\)`))
+		})
+
+		Context("when a new key is set", func() {
+			BeforeEach(func() {
+				args = []string{"merge", filepath.Join(dir, "prod.yml"), "--set", "resource_version_new.ref=1"}
+			})
+
+			It("refuses to add it", func() {
+				Eventually(session).Should(gexec.Exit(1))
+				Ω(session.Err).Should(Say("pass --allow-new to add it"))
+			})
+		})
+
+		Context("when the base file has a header", func() {
+			header := "stopover:\n  schema_version: 1\n  team: main\n  pipeline: prod\n  generated_at: 2021-06-07T12:00:00Z\n  stopover_version: 1.2.3\n"
+
+			BeforeEach(func() {
+				Ω(ioutil.WriteFile(filepath.Join(dir, "prod.yml"), []byte(header+"resource_version_app:\n  ref: abc\nresource_version_config:\n  ref: def\n"), 0644)).Should(Succeed())
+			})
+
+			It("keeps it", func() {
+				Eventually(session).Should(gexec.Exit(0))
+				Ω(string(session.Out.Contents())).Should(Equal(header + "resource_version_app:\n  ref: fff\nresource_version_config:\n  ref: \"123\"\n"))
+			})
+		})
+	})
+
 	Context("when no arguments are provided", func() {
 		It("exits 1 and prints usage", func() {
 			Eventually(session).Should(gexec.Exit(1))
@@ -151,8 +458,8 @@ $ stopover https://ci.server.tld my-team my-pipeline my-job job-build-id`)
 			args = []string{"not-valid-url", "team", "pipeline", "job", "1"}
 		})
 
-		It("exits 1 with a useful error message", func() {
-			Eventually(session).Should(gexec.Exit(1))
+		It("exits with the transport error code and a useful error message", func() {
+			Eventually(session).Should(gexec.Exit(9))
 			Ω(session.Err.Contents()).Should(ContainSubstring("error getting build for job [Get \"not-valid-url/api/v1/teams/team/pipelines/pipeline/jobs/job/builds/1\": unsupported protocol scheme \"\"]"))
 		})
 	})
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/EngineerBetter/stopover/pkg/metrics"
+)
+
+// ClientConfig controls how requests to the ATC are timed out, retried and
+// measured.
+type ClientConfig struct {
+	// Timeout bounds each individual request attempt, including reading the
+	// response body. Zero means no per-attempt timeout.
+	Timeout time.Duration
+	// Retries is the number of additional attempts made for idempotent
+	// requests that fail with a connection error or a 5xx response.
+	Retries int
+	// Backoff is the delay before the first retry; it doubles on each
+	// subsequent retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Metrics, if set, records every request attempt.
+	Metrics *metrics.Metrics
+}
+
+var DefaultClientConfig = ClientConfig{
+	Timeout:    30 * time.Second,
+	Retries:    3,
+	Backoff:    time.Second,
+	MaxBackoff: 30 * time.Second,
+}
+
+// retryTransport retries idempotent requests with exponential backoff, and
+// ties every request to ctx so that cancelling it aborts in-flight calls.
+type retryTransport struct {
+	ctx    context.Context
+	base   http.RoundTripper
+	config ClientConfig
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	attempts := 1
+	if isIdempotent(req) {
+		attempts += t.config.Retries
+	}
+
+	backoff := t.config.Backoff
+	for attempt := 1; ; attempt++ {
+		resp, err := t.attempt(req)
+
+		retryable := isRetryableErr(err) || (err == nil && resp.StatusCode >= 500)
+		if !retryable || attempt >= attempts || t.ctx.Err() != nil {
+			return resp, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-t.ctx.Done():
+			return nil, t.ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if t.config.MaxBackoff > 0 && backoff > t.config.MaxBackoff {
+			backoff = t.config.MaxBackoff
+		}
+	}
+}
+
+func (t *retryTransport) attempt(req *http.Request) (*http.Response, error) {
+	ctx, cancel := t.ctx, context.CancelFunc(func() {})
+	if t.config.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(t.ctx, t.config.Timeout)
+	}
+
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func isIdempotent(req *http.Request) bool {
+	return (req.Method == http.MethodGet || req.Method == http.MethodHead) && (req.Body == nil || req.Body == http.NoBody)
+}
+
+// isRetryableErr reports whether err looks like a transient connection
+// failure, as opposed to a malformed request that will never succeed.
+func isRetryableErr(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// cancelOnClose releases the per-attempt context once the caller has finished
+// with the response body.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var _ = Describe("retryTransport", func() {
+	var server *httptest.Server
+	var requests int32
+	var failures int32
+	var handlerDelay time.Duration
+	var ctx context.Context
+	var cancel context.CancelFunc
+	var config ClientConfig
+	var client *http.Client
+
+	BeforeEach(func() {
+		atomic.StoreInt32(&requests, 0)
+		failures = 0
+		handlerDelay = 0
+		config = ClientConfig{
+			Timeout:    time.Second,
+			Retries:    3,
+			Backoff:    time.Millisecond,
+			MaxBackoff: 5 * time.Millisecond,
+		}
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&requests, 1)
+			if n <= atomic.LoadInt32(&failures) {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			time.Sleep(handlerDelay)
+			w.Write([]byte("ok"))
+		}))
+
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+
+	JustBeforeEach(func() {
+		client = &http.Client{Transport: &retryTransport{ctx: ctx, base: http.DefaultTransport, config: config}}
+	})
+
+	AfterEach(func() {
+		cancel()
+		server.Close()
+	})
+
+	Context("when the server returns 5xx fewer times than the retry limit", func() {
+		BeforeEach(func() {
+			failures = 2
+		})
+
+		It("retries GETs until they succeed", func() {
+			resp, err := client.Get(server.URL)
+			Ω(err).ShouldNot(HaveOccurred())
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(body)).Should(Equal("ok"))
+			Ω(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(3))
+		})
+
+		It("does not retry non-idempotent requests", func() {
+			resp, err := client.Post(server.URL, "application/json", strings.NewReader("{}"))
+			Ω(err).ShouldNot(HaveOccurred())
+			resp.Body.Close()
+
+			Ω(resp.StatusCode).Should(Equal(http.StatusBadGateway))
+			Ω(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(1))
+		})
+	})
+
+	Context("when the server keeps failing", func() {
+		BeforeEach(func() {
+			failures = 100
+		})
+
+		It("gives up after the configured number of retries", func() {
+			resp, err := client.Get(server.URL)
+			Ω(err).ShouldNot(HaveOccurred())
+			resp.Body.Close()
+
+			Ω(resp.StatusCode).Should(Equal(http.StatusBadGateway))
+			Ω(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(4))
+		})
+	})
+
+	Context("when an attempt exceeds the timeout", func() {
+		BeforeEach(func() {
+			config.Timeout = 50 * time.Millisecond
+			config.Retries = 1
+			handlerDelay = 200 * time.Millisecond
+		})
+
+		It("times out each attempt and retries", func() {
+			_, err := client.Get(server.URL)
+			Ω(err).Should(MatchError(ContainSubstring("deadline exceeded")))
+			Ω(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(2))
+		})
+	})
+
+	Context("when the context is cancelled", func() {
+		BeforeEach(func() {
+			failures = 100
+			config.Backoff = time.Hour
+		})
+
+		It("stops retrying and returns the context error", func() {
+			go func() {
+				defer GinkgoRecover()
+				Eventually(func() int32 { return atomic.LoadInt32(&requests) }).Should(BeEquivalentTo(1))
+				cancel()
+			}()
+
+			_, err := client.Get(server.URL)
+			Ω(err).Should(MatchError(ContainSubstring("context canceled")))
+			Ω(atomic.LoadInt32(&requests)).Should(BeEquivalentTo(1))
+		})
+	})
+})
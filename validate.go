@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+)
+
+const validateUsage = `Usage:
+$ stopover validate versions.yml
+
+Checks a versions file against the versions file JSON Schema, reporting each
+problem found on stderr. Pass - to read the file from stdin.`
+
+func validateCommand(args []string) {
+	flags := flag.NewFlagSet("stopover validate", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		printUsageAndExit(flags, validateUsage, ExitFailure)
+	}
+
+	path := flags.Arg(0)
+	data, err := readFileOrStdin(path)
+	exitIfErr(err)
+
+	problems, err := stopover.Validate(data)
+	if err != nil {
+		exitIfErr(fmt.Errorf("parsing %s: %s", path, err))
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, problem)
+	}
+
+	if len(problems) > 0 {
+		exitIfErr(fmt.Errorf("%s is not a valid versions file", path))
+	}
+
+	fmt.Printf("%s is a valid versions file\n", path)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/EngineerBetter/stopover/pkg/metrics"
+	"github.com/EngineerBetter/stopover/pkg/publish"
+	"github.com/EngineerBetter/stopover/pkg/stopover"
+	"github.com/EngineerBetter/stopover/pkg/watch"
+	"github.com/concourse/concourse/atc"
+)
+
+const watchUsage = `Usage:
+$ export ATC_BEARER_TOKEN="eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9.eyJj....."
+$ stopover watch [--dir DIR] [--webhook URL] [--publish TARGET] [--allow-disabled] https://ci.server.tld my-team my-pipeline/my-job...
+
+Polls each job and emits a snapshot of every new succeeded build. Builds
+containing disabled versions are skipped unless --allow-disabled.`
+
+func watchCommand(args []string) {
+	flags := flag.NewFlagSet("stopover watch", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	var clientFlags clientFlags
+	clientFlags.register(flags)
+	var snapshotFlags snapshotFlags
+	snapshotFlags.register(flags)
+	var publishFlags publishFlags
+	publishFlags.register(flags)
+	interval := flags.Duration("interval", watch.DefaultInterval, "how often to poll the jobs")
+	statePath := flags.String("state", "stopover-watch.json", "file recording the builds of each job still to be handled")
+	maxAttempts := flags.Int("max-attempts", watch.DefaultMaxAttempts, "how many times to try emitting a build before skipping it")
+	dir := flags.String("dir", "", "write each versions file to DIR/{team}/{pipeline}/{job}/{build}.yml")
+	webhook := flags.String("webhook", "", "POST each versions file to this URL")
+	historyPath := flags.String("history", "", "record each snapshot in the history store at this path")
+	metricsListen := flags.String("metrics-listen", "", "serve Prometheus metrics on /metrics at this address, e.g. :9090")
+	allowDisabled := flags.Bool("allow-disabled", false, "emit snapshots containing disabled versions rather than skipping them")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() < 3 || os.Getenv("ATC_BEARER_TOKEN") == "" {
+		printUsageAndExit(flags, watchUsage, ExitFailure)
+	}
+
+	url := flags.Arg(0)
+	team := flags.Arg(1)
+
+	var jobs []stopover.BuildRef
+	for _, arg := range flags.Args()[2:] {
+		parts := strings.SplitN(arg, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			printUsageAndExit(flags, watchUsage, ExitFailure)
+		}
+		jobs = append(jobs, stopover.BuildRef{Team: team, Pipeline: atc.PipelineRef{Name: parts[0]}, Job: parts[1]})
+	}
+
+	var targets []string
+	if *dir != "" {
+		targets = append(targets, "file:"+strings.TrimSuffix(*dir, "/")+"/{team}/{pipeline}/{job}/{build}.yml")
+	}
+	if *webhook != "" {
+		targets = append(targets, *webhook)
+	}
+	if publishFlags.target != "" {
+		targets = append(targets, publishFlags.target)
+	}
+
+	var publishers []publish.Publisher
+	for _, target := range targets {
+		publisher, err := publish.New(target, publishFlags.config)
+		exitIfErr(err)
+		publishers = append(publishers, publisher)
+	}
+
+	var m *metrics.Metrics
+	if *metricsListen != "" {
+		m = metrics.New()
+		clientFlags.config.Metrics = m
+		serveMetrics(*metricsListen, m)
+	}
+
+	ctx, cancel := clientFlags.context()
+	defer cancel()
+	client := clientFlags.client(ctx, url)
+
+	handler := func(ctx context.Context, snapshot *stopover.Snapshot) error {
+		yaml, err := stopover.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+
+		for _, publisher := range publishers {
+			location, err := publisher.Publish(ctx, snapshot, yaml)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(os.Stderr, "published", location)
+		}
+
+		// Failed builds are retried, so history is only recorded once every
+		// publisher has succeeded, to avoid recording a build twice.
+		if *historyPath != "" {
+			if err := recordHistory(*historyPath, snapshot); err != nil {
+				return err
+			}
+		}
+
+		if len(publishers) == 0 {
+			fmt.Printf("# %s/%s build %s\n%s", snapshot.Source.PipelineRef().String(), snapshot.Source.Job, snapshot.Source.Build, yaml)
+		}
+
+		return nil
+	}
+
+	watcher, err := watch.New(client, snapshotFlags.snapshotter(client), watch.Config{
+		Jobs:        jobs,
+		Interval:    *interval,
+		StatePath:   *statePath,
+		Handler:     handler,
+		MaxAttempts: *maxAttempts,
+		Logf: func(format string, args ...interface{}) {
+			fmt.Fprintf(os.Stderr, format+"\n", args...)
+		},
+		Metrics:       m,
+		AllowDisabled: *allowDisabled,
+	})
+	exitIfErr(err)
+
+	fmt.Fprintf(os.Stderr, "watching %d job(s) every %s\n", len(jobs), *interval)
+	watcher.Run(ctx)
+}
+
+// serveMetrics serves m on /metrics at addr in the background, exiting if it
+// cannot listen.
+func serveMetrics(addr string, m *metrics.Metrics) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+
+	go func() {
+		exitIfErr(http.ListenAndServe(addr, mux))
+	}()
+}